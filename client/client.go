@@ -2,20 +2,63 @@ package client
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"net/url"
 	"os"
+	"slices"
 	"strconv"
 	"strings"
+	"time"
 
+	"github.com/guardian/cq-source-github-languages/internal/github"
 	"github.com/rs/zerolog"
 )
 
+// Minimum team permissions for team_permission, in increasing order of access
+const (
+	TeamPermissionPush     = "push"
+	TeamPermissionMaintain = "maintain"
+	TeamPermissionAdmin    = "admin"
+)
+
+// defaultRequestTimeout bounds each request to GitHub when request_timeout isn't set
+const defaultRequestTimeout = time.Minute
+
+// Org is an organization to sync, with the GitHub App installation to use for it.
+// An InstallationID of zero means the installation is discovered from the organization.
+type Org struct {
+	Name           string
+	InstallationID int64
+}
+
+// Repository is an entry in the repositories list
+type Repository struct {
+	Owner string
+	Name  string
+}
+
+func (r Repository) String() string {
+	return r.Owner + "/" + r.Name
+}
+
 type Client struct {
 	logger         zerolog.Logger
 	Spec           Spec
+	Orgs           []Org
 	AppID          int64
 	InstallationID int64
 	PrivateKey     string
+	Permissions    map[string]string
+	Token          string
+	Filter         RepositoryFilter
+	Repositories   []Repository
+	Teams          []string
+	TeamPermission string
+	org            string
+	opts           github.Options
+	gitHubClients  map[string]*github.Client
+	memo           *memo
 }
 
 func (c *Client) ID() string {
@@ -27,83 +70,514 @@ func (c *Client) Logger() *zerolog.Logger {
 }
 
 func (c *Client) Org() string {
-	return c.Spec.Org
+	return c.org
+}
+
+// GitHub returns the authenticated GitHub client for the current organization, or nil before Connect is called
+func (c *Client) GitHub() *github.Client {
+	return c.gitHubClients[c.org]
+}
+
+// Connect builds the authenticated GitHub client for each organization. Clients are built once
+// per sync and shared by every table resolver, so tokens are refreshed in one place.
+func (c *Client) Connect(ctx context.Context) error {
+	clients := make(map[string]*github.Client, len(c.Orgs))
+	var shared *github.Client
+	for _, org := range c.Orgs {
+		// Every organization uses the same token, so they can share a client too
+		if shared != nil {
+			clients[org.Name] = shared
+			continue
+		}
+
+		gitHubClient, err := github.NewClientFromCredentials(ctx, github.Credentials{
+			Token:          c.Token,
+			AppID:          c.AppID,
+			InstallationID: org.InstallationID,
+			Org:            org.Name,
+			PrivateKeyPEM:  []byte(c.PrivateKey),
+			Permissions:    c.Permissions,
+		}, c.opts)
+		if err != nil {
+			return fmt.Errorf("failed to create GitHub client for org %s: %w", org.Name, err)
+		}
+		clients[org.Name] = gitHubClient
+		if c.Token != "" {
+			shared = gitHubClient
+		}
+	}
+	c.gitHubClients = clients
+	c.memo = &memo{entries: make(map[string]*memoEntry)}
+	return nil
+}
+
+// CheckPermissions returns an error if the installation token for any organization lacks a
+// permission the table requires. Tokens are not checked, as GitHub doesn't report their scopes here.
+func (c *Client) CheckPermissions(table string, required map[string]string) error {
+	for _, org := range c.Orgs {
+		gitHubClient := c.gitHubClients[org.Name]
+		if gitHubClient == nil {
+			continue
+		}
+		granted := gitHubClient.GrantedPermissions()
+		if granted == nil {
+			continue
+		}
+		if missing := github.MissingPermissions(required, granted); len(missing) > 0 {
+			return fmt.Errorf("table %s requires permissions %s, which the installation token for org %s was not granted - add them to permissions and to the GitHub App", table, strings.Join(missing, ", "), org.Name)
+		}
+	}
+	return nil
+}
+
+// WithOrg returns a copy of the client scoped to a single organization, used to multiplex syncs across orgs
+func (c *Client) WithOrg(org Org) *Client {
+	newClient := *c
+	newClient.logger = c.logger.With().Str("org", org.Name).Logger()
+	newClient.org = org.Name
+	newClient.InstallationID = org.InstallationID
+	return &newClient
 }
 
 func New(ctx context.Context, logger zerolog.Logger, s *Spec) (Client, error) {
-	var appID, installationID int64
+	var appID int64
 	var privateKeyContent string
 
 	// Validate required fields
-	if s.Org == "" {
-		return Client{}, fmt.Errorf("organization is required")
+	if s.Org == "" && len(s.Orgs) == 0 && !s.AllInstallations {
+		return Client{}, fmt.Errorf("organization is required (set org, orgs or all_installations)")
+	}
+	if s.Org != "" && len(s.Orgs) > 0 {
+		return Client{}, fmt.Errorf("only one of org or orgs may be configured")
+	}
+	if s.AllInstallations && (s.Org != "" || len(s.Orgs) > 0 || s.InstallationID != "") {
+		return Client{}, fmt.Errorf("all_installations cannot be combined with org, orgs or installation_id")
 	}
 
-	if s.AppID != "" {
-		// Handle potential file interpolation syntax
-		appIDStr := strings.TrimSpace(s.AppID)
-		if strings.HasPrefix(appIDStr, "${file:") && strings.HasSuffix(appIDStr, "}") {
-			logger.Warn().Msg("app_id appears to contain file interpolation syntax - ensure CloudQuery has processed this correctly")
-		}
+	if err := validateEndpoints(s); err != nil {
+		return Client{}, err
+	}
+	opts, err := githubOptions(s)
+	if err != nil {
+		return Client{}, err
+	}
+	opts.Logger = logger
+
+	filter, err := newRepositoryFilter(s)
+	if err != nil {
+		return Client{}, err
+	}
+	repositories, err := parseRepositories(s)
+	if err != nil {
+		return Client{}, err
+	}
+	teams, err := parseTeams(s)
+	if err != nil {
+		return Client{}, err
+	}
+	if len(repositories) > 0 && len(teams) > 0 {
+		return Client{}, fmt.Errorf("only one of repositories or teams may be configured")
+	}
+	if opts.InsecureSkipVerify {
+		logger.Warn().Msg("insecure_skip_verify is set - TLS certificates will not be verified")
+	}
 
-		var err error
-		appID, err = strconv.ParseInt(appIDStr, 10, 64)
+	// Exactly one authentication method must be configured
+	appConfigured := s.AppID != "" || s.InstallationID != "" || s.PrivateKey != "" || s.PrivateKeyPath != "" || len(s.PrivateKeyCommand) > 0
+	for _, o := range s.Orgs {
+		appConfigured = appConfigured || o.InstallationID != ""
+	}
+	tokenConfigured := s.Token != "" || s.TokenPath != ""
+	if appConfigured && tokenConfigured {
+		return Client{}, fmt.Errorf("only one authentication method may be configured: use either token/token_path or github app credentials (app_id, installation_id, private_key/private_key_path)")
+	}
+	if !appConfigured && !tokenConfigured {
+		return Client{}, fmt.Errorf("an authentication method is required: use either token/token_path or github app credentials (app_id, installation_id, private_key/private_key_path)")
+	}
+
+	orgs, err := parseOrgs(ctx, s)
+	if err != nil {
+		return Client{}, err
+	}
+
+	if tokenConfigured {
+		if s.AllInstallations {
+			return Client{}, fmt.Errorf("all_installations requires github app authentication")
+		}
+		if len(s.Permissions) > 0 || s.RestrictToRepositories {
+			return Client{}, fmt.Errorf("permissions and restrict_to_repositories require github app authentication")
+		}
+		if err := checkRepositoryOwners(repositories, orgs); err != nil {
+			return Client{}, err
+		}
+		tokenClient, err := newTokenClient(logger, s, orgs, opts, filter, repositories)
 		if err != nil {
-			return Client{}, fmt.Errorf("failed to parse app_id '%s' as integer: %w", appIDStr, err)
+			return Client{}, err
 		}
+		tokenClient.Teams = teams
+		tokenClient.TeamPermission = strings.ToLower(s.TeamPermission)
+		return tokenClient, nil
 	}
 
-	if s.InstallationID != "" {
-		// Handle potential file interpolation syntax
-		installIDStr := strings.TrimSpace(s.InstallationID)
-		if strings.HasPrefix(installIDStr, "${file:") && strings.HasSuffix(installIDStr, "}") {
-			logger.Warn().Msg("installation_id appears to contain file interpolation syntax - ensure CloudQuery has processed this correctly")
+	// Some selection options need permissions beyond the defaults, which are added unless permissions are configured
+	var selectionPermissions []selectionPermission
+	if len(teams) > 0 {
+		// Listing a team's repositories needs read access to the organization's members and teams
+		selectionPermissions = append(selectionPermissions, selectionPermission{option: "teams", name: "members"})
+	}
+	if len(filter.CustomProperties) > 0 {
+		selectionPermissions = append(selectionPermissions, selectionPermission{option: "custom_properties", name: "organization_custom_properties"})
+	}
+
+	permissions := s.Permissions
+	if len(permissions) == 0 {
+		permissions = github.DefaultPermissions()
+		for _, p := range selectionPermissions {
+			permissions[p.name] = "read"
+		}
+	}
+	if err := github.ValidatePermissions(permissions); err != nil {
+		return Client{}, fmt.Errorf("invalid permissions: %w", err)
+	}
+	for _, p := range selectionPermissions {
+		if len(github.MissingPermissions(map[string]string{p.name: "read"}, permissions)) > 0 {
+			return Client{}, fmt.Errorf("%s requires the %s:read permission - add it to permissions", p.option, p.name)
 		}
+	}
 
-		var err error
-		installationID, err = strconv.ParseInt(installIDStr, 10, 64)
+	if s.AppID != "" {
+		appID, err = parseID(ctx, "app_id", s.AppID)
 		if err != nil {
-			return Client{}, fmt.Errorf("failed to parse installation_id '%s' as integer: %w", installIDStr, err)
+			return Client{}, err
 		}
 	}
 
-	if s.PrivateKeyPath != "" {
-		keyBytes, err := os.ReadFile(s.PrivateKeyPath)
+	if keySource := privateKeySource(s); keySource != nil {
+		privateKeyContent, err = keySource.Resolve(ctx)
 		if err != nil {
-			return Client{}, fmt.Errorf("failed to read private key from file %s: %w", s.PrivateKeyPath, err)
+			return Client{}, fmt.Errorf("failed to load private key from %s: %w", keySource, err)
 		}
-		privateKeyContent = strings.TrimSpace(string(keyBytes))
-		logger.Info().Str("key_path", s.PrivateKeyPath).Msg("loaded private key from file")
-	} else if s.PrivateKey != "" {
-		privateKeyContent = strings.TrimSpace(s.PrivateKey)
-		logger.Info().Msg("using private key from config")
+		logger.Info().Str("key_source", keySource.String()).Msg("loaded private key")
 	}
 
 	if appID == 0 {
 		return Client{}, fmt.Errorf("github app id is required")
 	}
-	if installationID == 0 {
-		return Client{}, fmt.Errorf("github app installation id is required")
-	}
 	if privateKeyContent == "" {
-		return Client{}, fmt.Errorf("github app private key is required (either private_key or private_key_path)")
+		return Client{}, fmt.Errorf("github app private key is required (private_key, private_key_path or private_key_command)")
 	}
 
 	if !strings.Contains(privateKeyContent, "-----BEGIN") || !strings.Contains(privateKeyContent, "-----END") {
-		return Client{}, fmt.Errorf("private key must be in PEM format with proper BEGIN/END markers")
+		return Client{}, &ConnectionError{Code: CodeInvalidPrivateKey, Err: fmt.Errorf("private key must be in PEM format with proper BEGIN/END markers")}
+	}
+
+	// Parse the key now so problems are reported at configure time rather than mid-sync
+	rsaKey, err := github.ParsePrivateKey([]byte(privateKeyContent))
+	if err != nil {
+		return Client{}, &ConnectionError{Code: CodeInvalidPrivateKey, Err: fmt.Errorf("invalid github app private key: %w", err)}
+	}
+	fingerprint, err := github.PublicKeyFingerprint(rsaKey)
+	if err != nil {
+		return Client{}, &ConnectionError{Code: CodeInvalidPrivateKey, Err: fmt.Errorf("invalid github app private key: %w", err)}
+	}
+	logger.Info().Str("key_fingerprint", fingerprint).Msg("parsed github app private key")
+
+	if s.AllInstallations {
+		orgs, err = discoverInstallations(ctx, logger, appID, privateKeyContent, opts)
+		if err != nil {
+			return Client{}, err
+		}
+	}
+
+	if err := checkRepositoryOwners(repositories, orgs); err != nil {
+		return Client{}, err
+	}
+
+	for _, o := range orgs {
+		if o.InstallationID == 0 {
+			logger.Info().Str("org", o.Name).Msg("installation_id not set - the installation will be discovered from the organization")
+		}
 	}
 
 	logger.Info().
 		Int64("app_id", appID).
-		Int64("installation_id", installationID).
-		Str("org", s.Org).
+		Strs("orgs", orgNames(orgs)).
+		Interface("permissions", permissions).
 		Msg("GitHub App client configured successfully")
 
 	return Client{
 		logger:         logger,
 		Spec:           *s,
+		Orgs:           orgs,
 		AppID:          appID,
-		InstallationID: installationID,
+		InstallationID: orgs[0].InstallationID,
 		PrivateKey:     privateKeyContent,
+		Permissions:    permissions,
+		Filter:         filter,
+		Repositories:   repositories,
+		Teams:          teams,
+		TeamPermission: strings.ToLower(s.TeamPermission),
+		org:            orgs[0].Name,
+		opts:           opts,
+	}, nil
+}
+
+// newTokenClient configures a client that authenticates with a personal access token or fine-grained token
+func newTokenClient(logger zerolog.Logger, s *Spec, orgs []Org, opts github.Options, filter RepositoryFilter, repositories []Repository) (Client, error) {
+	var token string
+
+	if s.TokenPath != "" {
+		tokenBytes, err := os.ReadFile(s.TokenPath)
+		if err != nil {
+			return Client{}, fmt.Errorf("failed to read token from file %s: %w", s.TokenPath, err)
+		}
+		token = strings.TrimSpace(string(tokenBytes))
+		logger.Info().Str("token_path", s.TokenPath).Msg("loaded token from file")
+	} else if s.Token != "" {
+		token = strings.TrimSpace(s.Token)
+		logger.Info().Msg("using token from config")
+	}
+
+	if token == "" {
+		return Client{}, fmt.Errorf("github token is required (either token or token_path)")
+	}
+
+	logger.Info().
+		Strs("orgs", orgNames(orgs)).
+		Msg("GitHub token client configured successfully")
+
+	return Client{
+		logger:       logger,
+		Spec:         *s,
+		Orgs:         orgs,
+		Token:        token,
+		Filter:       filter,
+		Repositories: repositories,
+		org:          orgs[0].Name,
+		opts:         opts,
 	}, nil
 }
+
+// parseOrgs normalises the single org and orgs list forms of the spec into the organizations to sync
+func parseOrgs(ctx context.Context, s *Spec) ([]Org, error) {
+	if s.Org != "" {
+		org := Org{Name: s.Org}
+		if s.InstallationID != "" {
+			id, err := parseID(ctx, "installation_id", s.InstallationID)
+			if err != nil {
+				return nil, err
+			}
+			org.InstallationID = id
+		}
+		return []Org{org}, nil
+	}
+
+	if s.InstallationID != "" {
+		return nil, fmt.Errorf("installation_id can only be used with org - set installation_id on each entry in orgs instead")
+	}
+
+	orgs := make([]Org, 0, len(s.Orgs))
+	seen := make(map[string]bool, len(s.Orgs))
+	for i, o := range s.Orgs {
+		name := strings.TrimSpace(o.Name)
+		if name == "" {
+			return nil, fmt.Errorf("orgs[%d]: name is required", i)
+		}
+		if seen[strings.ToLower(name)] {
+			return nil, fmt.Errorf("orgs[%d]: organization %s is listed more than once", i, name)
+		}
+		seen[strings.ToLower(name)] = true
+
+		org := Org{Name: name}
+		if o.InstallationID != "" {
+			id, err := parseID(ctx, fmt.Sprintf("orgs[%d].installation_id", i), o.InstallationID)
+			if err != nil {
+				return nil, err
+			}
+			org.InstallationID = id
+		}
+		orgs = append(orgs, org)
+	}
+	return orgs, nil
+}
+
+// parseRepositories parses the owner/name entries in the repositories list
+func parseRepositories(s *Spec) ([]Repository, error) {
+	var repositories []Repository
+	seen := make(map[string]bool, len(s.Repositories))
+	for i, raw := range s.Repositories {
+		owner, name, ok := strings.Cut(strings.TrimSpace(raw), "/")
+		if !ok || owner == "" || name == "" || strings.Contains(name, "/") {
+			return nil, fmt.Errorf("repositories[%d]: must be in the form owner/name, got %q", i, raw)
+		}
+		repo := Repository{Owner: owner, Name: name}
+		if seen[strings.ToLower(repo.String())] {
+			return nil, fmt.Errorf("repositories[%d]: repository %s is listed more than once", i, repo)
+		}
+		seen[strings.ToLower(repo.String())] = true
+		repositories = append(repositories, repo)
+	}
+	return repositories, nil
+}
+
+// selectionPermission is a read permission the installation token needs for a repository selection option
+type selectionPermission struct {
+	option string
+	name   string
+}
+
+// parseTeams normalises the team slugs in the teams list and checks team_permission
+func parseTeams(s *Spec) ([]string, error) {
+	switch strings.ToLower(s.TeamPermission) {
+	case "", TeamPermissionPush, TeamPermissionMaintain, TeamPermissionAdmin:
+	default:
+		return nil, fmt.Errorf("team_permission must be %q, %q or %q, got %q", TeamPermissionPush, TeamPermissionMaintain, TeamPermissionAdmin, s.TeamPermission)
+	}
+	if s.TeamPermission != "" && len(s.Teams) == 0 {
+		return nil, fmt.Errorf("team_permission requires teams to be set")
+	}
+
+	var teams []string
+	for i, raw := range s.Teams {
+		slug := strings.ToLower(strings.TrimSpace(raw))
+		if slug == "" {
+			return nil, fmt.Errorf("teams[%d]: team slug must not be empty", i)
+		}
+		if slices.Contains(teams, slug) {
+			return nil, fmt.Errorf("teams[%d]: team %s is listed more than once", i, slug)
+		}
+		teams = append(teams, slug)
+	}
+	return teams, nil
+}
+
+// checkRepositoryOwners returns an error if a listed repository doesn't belong to one of the organizations being synced
+func checkRepositoryOwners(repositories []Repository, orgs []Org) error {
+	for _, repo := range repositories {
+		found := false
+		for _, org := range orgs {
+			found = found || strings.EqualFold(repo.Owner, org.Name)
+		}
+		if !found {
+			return fmt.Errorf("repository %s is not in any of the organizations being synced (%s)", repo, strings.Join(orgNames(orgs), ", "))
+		}
+	}
+	return nil
+}
+
+// OrgRepositories returns the entries in the repositories list that belong to the current organization
+func (c *Client) OrgRepositories() []Repository {
+	var repositories []Repository
+	for _, repo := range c.Repositories {
+		if strings.EqualFold(repo.Owner, c.org) {
+			repositories = append(repositories, repo)
+		}
+	}
+	return repositories
+}
+
+// discoverInstallations lists every organization the GitHub App is installed on, each with its own installation
+func discoverInstallations(ctx context.Context, logger zerolog.Logger, appID int64, privateKey string, opts github.Options) ([]Org, error) {
+	installations, err := github.ListOrgInstallations(ctx, appID, []byte(privateKey), opts)
+	if err != nil {
+		err = fmt.Errorf("failed to discover installations: %w", err)
+		if isUnauthorized(err) {
+			return nil, &ConnectionError{Code: CodeInvalidAppCredentials, Err: err}
+		}
+		return nil, err
+	}
+	if len(installations) == 0 {
+		return nil, fmt.Errorf("github app %d is not installed on any organizations", appID)
+	}
+
+	orgs := make([]Org, 0, len(installations))
+	for _, inst := range installations {
+		orgs = append(orgs, Org{Name: inst.Org, InstallationID: inst.ID})
+	}
+	logger.Info().Strs("orgs", orgNames(orgs)).Msg("discovered github app installations")
+	return orgs, nil
+}
+
+// parseID parses a numeric GitHub ID from the spec, where it is given as a string.
+// The value may also refer to an env: or file: source, including unprocessed ${file:...} interpolation.
+func parseID(ctx context.Context, name string, raw string) (int64, error) {
+	idStr, err := parseSecretSource(raw).Resolve(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to resolve %s: %w", name, err)
+	}
+
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse %s '%s' as integer: %w", name, idStr, err)
+	}
+	return id, nil
+}
+
+func orgNames(orgs []Org) []string {
+	names := make([]string, 0, len(orgs))
+	for _, o := range orgs {
+		names = append(names, o.Name)
+	}
+	return names
+}
+
+// validateEndpoints checks the GitHub Enterprise Server URLs, if any are configured
+func validateEndpoints(s *Spec) error {
+	if s.UploadURL != "" && s.BaseURL == "" {
+		return fmt.Errorf("upload_url requires base_url to be set")
+	}
+	for name, raw := range map[string]string{"base_url": s.BaseURL, "upload_url": s.UploadURL} {
+		if raw == "" {
+			continue
+		}
+		u, err := url.Parse(raw)
+		if err != nil {
+			return fmt.Errorf("failed to parse %s '%s': %w", name, raw, err)
+		}
+		if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("%s '%s' must be an absolute http(s) URL", name, raw)
+		}
+	}
+	return nil
+}
+
+// githubOptions builds the GitHub connection options from the spec, checking the proxy, CA bundle and timeout
+func githubOptions(s *Spec) (github.Options, error) {
+	opts := github.Options{
+		BaseURL:            s.BaseURL,
+		UploadURL:          s.UploadURL,
+		ProxyURL:           s.ProxyURL,
+		CABundlePath:       s.CABundlePath,
+		RequestTimeout:     defaultRequestTimeout,
+		InsecureSkipVerify: s.InsecureSkipVerify,
+	}
+
+	if s.ProxyURL != "" {
+		// Proxy URLs may carry a password, so they are never printed as given
+		u, err := url.Parse(s.ProxyURL)
+		if err != nil {
+			return github.Options{}, fmt.Errorf("failed to parse proxy_url: %w", errors.Unwrap(err))
+		}
+		if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return github.Options{}, fmt.Errorf("proxy_url '%s' must be an absolute http(s) URL", u.Redacted())
+		}
+	}
+
+	if s.CABundlePath != "" {
+		if _, err := github.LoadCABundle(s.CABundlePath); err != nil {
+			return github.Options{}, fmt.Errorf("invalid ca_bundle_path: %w", err)
+		}
+	}
+
+	if s.RequestTimeout != "" {
+		timeout, err := time.ParseDuration(s.RequestTimeout)
+		if err != nil {
+			return github.Options{}, fmt.Errorf("failed to parse request_timeout '%s' as a duration: %w", s.RequestTimeout, err)
+		}
+		if timeout <= 0 {
+			return github.Options{}, fmt.Errorf("request_timeout must be positive, got '%s'", s.RequestTimeout)
+		}
+		opts.RequestTimeout = timeout
+	}
+	return opts, nil
+}
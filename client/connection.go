@@ -0,0 +1,91 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	gh "github.com/google/go-github/v57/github"
+	"github.com/guardian/cq-source-github-languages/internal/github"
+)
+
+// Codes identifying which connection check failed, reported by `cloudquery test-connection`
+const (
+	CodeInvalidSpec            = "INVALID_SPEC"
+	CodeInvalidPrivateKey      = "INVALID_PRIVATE_KEY"
+	CodeInvalidAppCredentials  = "INVALID_APP_CREDENTIALS"
+	CodeInstallationNotFound   = "INSTALLATION_NOT_FOUND"
+	CodeRepositoryAccessDenied = "REPOSITORY_ACCESS_DENIED"
+)
+
+// ConnectionError is a failed connection check, with a code saying which check failed
+type ConnectionError struct {
+	Code string
+	Err  error
+}
+
+func (e *ConnectionError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *ConnectionError) Unwrap() error {
+	return e.Err
+}
+
+// ErrorCode returns the connection check code for an error returned by New or TestConnection.
+// Errors that don't come from a specific check are configuration problems.
+func ErrorCode(err error) string {
+	var connErr *ConnectionError
+	if errors.As(err, &connErr) {
+		return connErr.Code
+	}
+	return CodeInvalidSpec
+}
+
+// TestConnection checks, for each organization, that GitHub accepts the App's JWT, that the App
+// installation exists and belongs to the organization, and that a token can list the organization's
+// repositories. The private key itself is parsed by New. Failures are returned as a *ConnectionError.
+func (c *Client) TestConnection(ctx context.Context) error {
+	if c.Token == "" {
+		if err := github.VerifyApp(ctx, c.AppID, []byte(c.PrivateKey), c.opts); err != nil {
+			return &ConnectionError{Code: CodeInvalidAppCredentials, Err: err}
+		}
+	}
+
+	for _, org := range c.Orgs {
+		installationID := org.InstallationID
+		if c.Token == "" {
+			installation, err := github.FindInstallation(ctx, c.AppID, []byte(c.PrivateKey), org.Name, installationID, c.opts)
+			if err != nil {
+				return &ConnectionError{Code: CodeInstallationNotFound, Err: err}
+			}
+			installationID = installation.ID
+		}
+
+		gitHubClient, err := github.NewClientFromCredentials(ctx, github.Credentials{
+			Token:          c.Token,
+			AppID:          c.AppID,
+			InstallationID: installationID,
+			Org:            org.Name,
+			PrivateKeyPEM:  []byte(c.PrivateKey),
+			Permissions:    c.Permissions,
+		}, c.opts)
+		if err != nil {
+			return &ConnectionError{Code: CodeRepositoryAccessDenied, Err: fmt.Errorf("failed to create token for org %s: %w", org.Name, err)}
+		}
+
+		listOpts := &gh.RepositoryListByOrgOptions{ListOptions: gh.ListOptions{PerPage: 1}}
+		if _, _, err := gitHubClient.GitHubClient.Repositories.ListByOrg(ctx, org.Name, listOpts); err != nil {
+			return &ConnectionError{Code: CodeRepositoryAccessDenied, Err: fmt.Errorf("failed to list repositories for org %s: %w - check the token can read the organization's repositories", org.Name, err)}
+		}
+		c.logger.Info().Str("org", org.Name).Msg("connection test passed")
+	}
+	return nil
+}
+
+// isUnauthorized reports whether err is GitHub rejecting the request's credentials
+func isUnauthorized(err error) bool {
+	var errResp *gh.ErrorResponse
+	return errors.As(err, &errResp) && errResp.Response != nil && errResp.Response.StatusCode == http.StatusUnauthorized
+}
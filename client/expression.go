@@ -0,0 +1,522 @@
+package client
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	gh "github.com/google/go-github/v57/github"
+)
+
+// Expression is a compiled repo_filter, a boolean expression over repository fields such as
+// "production" in topics && !archived && pushed_at > now() - 365d
+type Expression struct {
+	source string
+	root   exprNode
+	now    func() time.Time
+}
+
+// String returns the expression as it was configured
+func (e *Expression) String() string {
+	return e.source
+}
+
+// Match reports whether the repository satisfies the expression
+func (e *Expression) Match(repo *gh.Repository) bool {
+	env := &exprEnv{repo: repo, now: e.now()}
+	return e.root.eval(env).(bool)
+}
+
+// CompileExpression parses and type checks a repo_filter expression
+func CompileExpression(source string) (*Expression, error) {
+	tokens, err := lexExpression(source)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &exprParser{tokens: tokens}
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if tok := p.peek(); tok.kind != tokEOF {
+		return nil, exprErrorf(tok.pos, "unexpected %s", tok)
+	}
+	if root.typ != typeBool {
+		return nil, fmt.Errorf("expression must be true or false, but it is a %s", root.typ)
+	}
+	return &Expression{source: source, root: root, now: time.Now}, nil
+}
+
+type valueType int
+
+const (
+	typeBool valueType = iota + 1
+	typeNumber
+	typeString
+	typeTime
+	typeDuration
+	typeList
+)
+
+func (t valueType) String() string {
+	switch t {
+	case typeBool:
+		return "boolean"
+	case typeNumber:
+		return "number"
+	case typeString:
+		return "string"
+	case typeTime:
+		return "time"
+	case typeDuration:
+		return "duration"
+	case typeList:
+		return "list"
+	default:
+		return "unknown"
+	}
+}
+
+// exprEnv is what an expression is evaluated against. now is fixed per repository so now() is consistent within it.
+type exprEnv struct {
+	repo *gh.Repository
+	now  time.Time
+}
+
+// exprNode is a type checked part of an expression. eval returns a bool, float64, string, time.Time,
+// time.Duration or []string according to typ.
+type exprNode struct {
+	typ  valueType
+	eval func(env *exprEnv) any
+}
+
+type exprField struct {
+	typ valueType
+	get func(repo *gh.Repository) any
+}
+
+// exprFields are the repository fields an expression can refer to
+var exprFields = map[string]exprField{
+	"name":       {typeString, func(r *gh.Repository) any { return r.GetName() }},
+	"full_name":  {typeString, func(r *gh.Repository) any { return r.GetFullName() }},
+	"language":   {typeString, func(r *gh.Repository) any { return r.GetLanguage() }},
+	"visibility": {typeString, func(r *gh.Repository) any { return repositoryVisibility(r) }},
+	"topics":     {typeList, func(r *gh.Repository) any { return r.Topics }},
+	"archived":   {typeBool, func(r *gh.Repository) any { return r.GetArchived() }},
+	"fork":       {typeBool, func(r *gh.Repository) any { return r.GetFork() }},
+	"template":   {typeBool, func(r *gh.Repository) any { return r.GetIsTemplate() }},
+	"private":    {typeBool, func(r *gh.Repository) any { return r.GetPrivate() }},
+	"size":       {typeNumber, func(r *gh.Repository) any { return float64(r.GetSize()) }},
+	"stars":      {typeNumber, func(r *gh.Repository) any { return float64(r.GetStargazersCount()) }},
+	"created_at": {typeTime, func(r *gh.Repository) any { return r.GetCreatedAt().Time }},
+	"updated_at": {typeTime, func(r *gh.Repository) any { return r.GetUpdatedAt().Time }},
+	"pushed_at":  {typeTime, func(r *gh.Repository) any { return r.GetPushedAt().Time }},
+}
+
+// durationUnits are the suffixes allowed on duration literals such as 365d
+var durationUnits = map[string]time.Duration{
+	"s": time.Second,
+	"m": time.Minute,
+	"h": time.Hour,
+	"d": 24 * time.Hour,
+	"w": 7 * 24 * time.Hour,
+}
+
+func exprErrorf(pos int, format string, args ...any) error {
+	return fmt.Errorf("%s at position %d", fmt.Sprintf(format, args...), pos+1)
+}
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokIdent
+	tokString
+	tokNumber
+	tokDuration
+	tokOp
+)
+
+type exprToken struct {
+	kind tokenKind
+	text string
+	pos  int
+	val  any
+}
+
+func (t exprToken) String() string {
+	if t.kind == tokEOF {
+		return "end of expression"
+	}
+	return strconv.Quote(t.text)
+}
+
+func isLetter(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c == '_'
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func lexExpression(src string) ([]exprToken, error) {
+	var tokens []exprToken
+	for i := 0; i < len(src); {
+		c := src[i]
+		start := i
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case isLetter(c):
+			for i < len(src) && (isLetter(src[i]) || isDigit(src[i])) {
+				i++
+			}
+			tokens = append(tokens, exprToken{kind: tokIdent, text: src[start:i], pos: start})
+		case isDigit(c):
+			for i < len(src) && (isDigit(src[i]) || src[i] == '.') {
+				i++
+			}
+			n, err := strconv.ParseFloat(src[start:i], 64)
+			if err != nil {
+				return nil, exprErrorf(start, "invalid number %q", src[start:i])
+			}
+			if i == len(src) || !isLetter(src[i]) {
+				tokens = append(tokens, exprToken{kind: tokNumber, text: src[start:i], pos: start, val: n})
+				break
+			}
+			unitStart := i
+			for i < len(src) && isLetter(src[i]) {
+				i++
+			}
+			unit, ok := durationUnits[src[unitStart:i]]
+			if !ok {
+				return nil, exprErrorf(unitStart, "invalid duration unit %q, must be one of s, m, h, d or w", src[unitStart:i])
+			}
+			tokens = append(tokens, exprToken{kind: tokDuration, text: src[start:i], pos: start, val: time.Duration(n * float64(unit))})
+		case c == '"' || c == '\'':
+			var b strings.Builder
+			i++
+			for ; i < len(src) && src[i] != c; i++ {
+				if src[i] == '\\' && i+1 < len(src) {
+					i++
+				}
+				b.WriteByte(src[i])
+			}
+			if i == len(src) {
+				return nil, exprErrorf(start, "unterminated string")
+			}
+			i++
+			tokens = append(tokens, exprToken{kind: tokString, text: src[start:i], pos: start, val: b.String()})
+		default:
+			if i+1 < len(src) && slices.Contains([]string{"&&", "||", "==", "!=", "<=", ">="}, src[i:i+2]) {
+				i += 2
+			} else if strings.IndexByte("!<>+-()[],", c) >= 0 {
+				i++
+			} else {
+				return nil, exprErrorf(start, "unexpected character %q", c)
+			}
+			tokens = append(tokens, exprToken{kind: tokOp, text: src[start:i], pos: start})
+		}
+	}
+	return append(tokens, exprToken{kind: tokEOF, pos: len(src)}), nil
+}
+
+// exprParser is a recursive descent parser. From lowest to highest precedence the grammar is
+// ||, &&, !, comparisons (== != < <= > >= in), + and -, then literals, fields, now() and parentheses.
+type exprParser struct {
+	tokens []exprToken
+	pos    int
+}
+
+func (p *exprParser) peek() exprToken {
+	return p.tokens[p.pos]
+}
+
+func (p *exprParser) next() exprToken {
+	tok := p.tokens[p.pos]
+	if tok.kind != tokEOF {
+		p.pos++
+	}
+	return tok
+}
+
+// accept consumes the next token if it is the given operator or keyword
+func (p *exprParser) accept(text string) bool {
+	if tok := p.peek(); (tok.kind == tokOp || tok.kind == tokIdent) && tok.text == text {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *exprParser) expect(text string) error {
+	if !p.accept(text) {
+		tok := p.peek()
+		return exprErrorf(tok.pos, "expected %q but found %s", text, tok)
+	}
+	return nil
+}
+
+func (p *exprParser) parseOr() (exprNode, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return exprNode{}, err
+	}
+	for {
+		pos := p.peek().pos
+		if !p.accept("||") {
+			return left, nil
+		}
+		right, err := p.parseAnd()
+		if err != nil {
+			return exprNode{}, err
+		}
+		if left.typ != typeBool || right.typ != typeBool {
+			return exprNode{}, exprErrorf(pos, "|| needs booleans, not %s and %s", left.typ, right.typ)
+		}
+		l, r := left.eval, right.eval
+		left = exprNode{typ: typeBool, eval: func(env *exprEnv) any { return l(env).(bool) || r(env).(bool) }}
+	}
+}
+
+func (p *exprParser) parseAnd() (exprNode, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return exprNode{}, err
+	}
+	for {
+		pos := p.peek().pos
+		if !p.accept("&&") {
+			return left, nil
+		}
+		right, err := p.parseNot()
+		if err != nil {
+			return exprNode{}, err
+		}
+		if left.typ != typeBool || right.typ != typeBool {
+			return exprNode{}, exprErrorf(pos, "&& needs booleans, not %s and %s", left.typ, right.typ)
+		}
+		l, r := left.eval, right.eval
+		left = exprNode{typ: typeBool, eval: func(env *exprEnv) any { return l(env).(bool) && r(env).(bool) }}
+	}
+}
+
+func (p *exprParser) parseNot() (exprNode, error) {
+	pos := p.peek().pos
+	if !p.accept("!") {
+		return p.parseComparison()
+	}
+	operand, err := p.parseNot()
+	if err != nil {
+		return exprNode{}, err
+	}
+	if operand.typ != typeBool {
+		return exprNode{}, exprErrorf(pos, "! needs a boolean, not %s", operand.typ)
+	}
+	return exprNode{typ: typeBool, eval: func(env *exprEnv) any { return !operand.eval(env).(bool) }}, nil
+}
+
+func (p *exprParser) parseComparison() (exprNode, error) {
+	left, err := p.parseAdditive()
+	if err != nil {
+		return exprNode{}, err
+	}
+
+	tok := p.peek()
+	op := tok.text
+	if !(tok.kind == tokOp && slices.Contains([]string{"==", "!=", "<", "<=", ">", ">="}, op)) && !(tok.kind == tokIdent && op == "in") {
+		return left, nil
+	}
+	p.next()
+	right, err := p.parseAdditive()
+	if err != nil {
+		return exprNode{}, err
+	}
+	l, r := left.eval, right.eval
+
+	switch {
+	case op == "in" && left.typ == typeString && right.typ == typeList:
+		return exprNode{typ: typeBool, eval: func(env *exprEnv) any {
+			s := l(env).(string)
+			return slices.ContainsFunc(r(env).([]string), func(item string) bool { return strings.EqualFold(item, s) })
+		}}, nil
+	case op == "in" && left.typ == typeString && right.typ == typeString:
+		return exprNode{typ: typeBool, eval: func(env *exprEnv) any {
+			return strings.Contains(strings.ToLower(r(env).(string)), strings.ToLower(l(env).(string)))
+		}}, nil
+	case op == "in":
+		return exprNode{}, exprErrorf(tok.pos, "in needs a string and a list or string, not %s and %s", left.typ, right.typ)
+	case left.typ != right.typ:
+		return exprNode{}, exprErrorf(tok.pos, "cannot compare %s with %s", left.typ, right.typ)
+	case left.typ == typeList:
+		return exprNode{}, exprErrorf(tok.pos, "cannot compare lists - use in to test for an item")
+	case (left.typ == typeBool || left.typ == typeString) && op != "==" && op != "!=":
+		return exprNode{}, exprErrorf(tok.pos, "%s cannot be used with %s values", op, left.typ)
+	}
+
+	return exprNode{typ: typeBool, eval: func(env *exprEnv) any {
+		c := compareValues(l(env), r(env))
+		switch op {
+		case "==":
+			return c == 0
+		case "!=":
+			return c != 0
+		case "<":
+			return c < 0
+		case "<=":
+			return c <= 0
+		case ">":
+			return c > 0
+		default:
+			return c >= 0
+		}
+	}}, nil
+}
+
+// compareValues orders two values of the same type. Strings compare equal regardless of case.
+func compareValues(a, b any) int {
+	switch a := a.(type) {
+	case bool:
+		if a == b.(bool) {
+			return 0
+		}
+		return 1
+	case string:
+		if strings.EqualFold(a, b.(string)) {
+			return 0
+		}
+		return strings.Compare(strings.ToLower(a), strings.ToLower(b.(string)))
+	case float64:
+		return compareOrdered(a, b.(float64))
+	case time.Duration:
+		return compareOrdered(a, b.(time.Duration))
+	case time.Time:
+		return a.Compare(b.(time.Time))
+	default:
+		return 0
+	}
+}
+
+func compareOrdered[T float64 | time.Duration](a, b T) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	default:
+		return 0
+	}
+}
+
+func (p *exprParser) parseAdditive() (exprNode, error) {
+	left, err := p.parsePrimary()
+	if err != nil {
+		return exprNode{}, err
+	}
+	for {
+		tok := p.peek()
+		if !p.accept("+") && !p.accept("-") {
+			return left, nil
+		}
+		right, err := p.parsePrimary()
+		if err != nil {
+			return exprNode{}, err
+		}
+		if left, err = arithmetic(tok, left, right); err != nil {
+			return exprNode{}, err
+		}
+	}
+}
+
+// arithmetic adds or subtracts numbers and durations, moves times by durations, and subtracts times
+func arithmetic(op exprToken, left, right exprNode) (exprNode, error) {
+	l, r := left.eval, right.eval
+	sign := 1.0
+	if op.text == "-" {
+		sign = -1
+	}
+
+	switch {
+	case left.typ == typeNumber && right.typ == typeNumber:
+		return exprNode{typ: typeNumber, eval: func(env *exprEnv) any { return l(env).(float64) + sign*r(env).(float64) }}, nil
+	case left.typ == typeDuration && right.typ == typeDuration:
+		return exprNode{typ: typeDuration, eval: func(env *exprEnv) any {
+			return l(env).(time.Duration) + time.Duration(sign)*r(env).(time.Duration)
+		}}, nil
+	case left.typ == typeTime && right.typ == typeDuration:
+		return exprNode{typ: typeTime, eval: func(env *exprEnv) any {
+			return l(env).(time.Time).Add(time.Duration(sign) * r(env).(time.Duration))
+		}}, nil
+	case left.typ == typeTime && right.typ == typeTime && op.text == "-":
+		return exprNode{typ: typeDuration, eval: func(env *exprEnv) any { return l(env).(time.Time).Sub(r(env).(time.Time)) }}, nil
+	default:
+		return exprNode{}, exprErrorf(op.pos, "cannot use %s with %s and %s", op.text, left.typ, right.typ)
+	}
+}
+
+func (p *exprParser) parsePrimary() (exprNode, error) {
+	tok := p.next()
+	switch tok.kind {
+	case tokString:
+		return constant(typeString, tok.val), nil
+	case tokNumber:
+		return constant(typeNumber, tok.val), nil
+	case tokDuration:
+		return constant(typeDuration, tok.val), nil
+	case tokOp:
+		switch tok.text {
+		case "(":
+			node, err := p.parseOr()
+			if err != nil {
+				return exprNode{}, err
+			}
+			return node, p.expect(")")
+		case "[":
+			return p.parseList()
+		}
+	case tokIdent:
+		switch tok.text {
+		case "true", "false":
+			return constant(typeBool, tok.text == "true"), nil
+		case "now":
+			if err := p.expect("("); err != nil {
+				return exprNode{}, err
+			}
+			if err := p.expect(")"); err != nil {
+				return exprNode{}, err
+			}
+			return exprNode{typ: typeTime, eval: func(env *exprEnv) any { return env.now }}, nil
+		}
+		field, ok := exprFields[tok.text]
+		if !ok {
+			return exprNode{}, exprErrorf(tok.pos, "unknown field %q", tok.text)
+		}
+		return exprNode{typ: field.typ, eval: func(env *exprEnv) any { return field.get(env.repo) }}, nil
+	}
+	return exprNode{}, exprErrorf(tok.pos, "unexpected %s", tok)
+}
+
+// parseList parses a list of string literals such as ["Go", "Scala"], after the opening bracket
+func (p *exprParser) parseList() (exprNode, error) {
+	items := []string{}
+	for !p.accept("]") {
+		if len(items) > 0 {
+			if err := p.expect(","); err != nil {
+				return exprNode{}, err
+			}
+		}
+		tok := p.next()
+		if tok.kind != tokString {
+			return exprNode{}, exprErrorf(tok.pos, "lists may only contain strings, found %s", tok)
+		}
+		items = append(items, tok.val.(string))
+	}
+	return constant(typeList, items), nil
+}
+
+func constant(typ valueType, val any) exprNode {
+	return exprNode{typ: typ, eval: func(*exprEnv) any { return val }}
+}
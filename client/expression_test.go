@@ -0,0 +1,105 @@
+package client
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	gh "github.com/google/go-github/v57/github"
+)
+
+func TestExpressionMatch(t *testing.T) {
+	now := time.Date(2026, 6, 1, 0, 0, 0, 0, time.UTC)
+	active := &gh.Repository{
+		Name:       gh.String("payments-api"),
+		Topics:     []string{"production", "api"},
+		Archived:   gh.Bool(false),
+		Fork:       gh.Bool(false),
+		Visibility: gh.String("private"),
+		Language:   gh.String("Scala"),
+		Size:       gh.Int(2048),
+		PushedAt:   &gh.Timestamp{Time: now.AddDate(0, -1, 0)},
+		CreatedAt:  &gh.Timestamp{Time: now.AddDate(-3, 0, 0)},
+	}
+	dormant := &gh.Repository{
+		Name:       gh.String("legacy-sandbox"),
+		Topics:     []string{"production"},
+		Archived:   gh.Bool(true),
+		Fork:       gh.Bool(true),
+		Visibility: gh.String("public"),
+		Language:   gh.String("Go"),
+		Size:       gh.Int(0),
+		PushedAt:   &gh.Timestamp{Time: now.AddDate(-2, 0, 0)},
+	}
+
+	tests := []struct {
+		expr    string
+		active  bool
+		dormant bool
+	}{
+		{expr: `"production" in topics && !archived && pushed_at > now() - 365d`, active: true, dormant: false},
+		{expr: `"api" in topics || fork`, active: true, dormant: true},
+		{expr: `!("api" in topics)`, active: false, dormant: true},
+		{expr: `!"api" in topics`, active: false, dormant: true},
+		{expr: `visibility == "PRIVATE"`, active: true, dormant: false},
+		{expr: `visibility != "private" && size == 0`, active: false, dormant: true},
+		{expr: `language in ["go", "Python"]`, active: false, dormant: true},
+		{expr: `"sandbox" in name`, active: false, dormant: true},
+		{expr: `size >= 1024 && size < 4096`, active: true, dormant: false},
+		{expr: `now() - pushed_at <= 4w + 3d`, active: true, dormant: false},
+		// dormant has no created_at, which is treated as the zero time
+		{expr: `created_at < now() - 365d`, active: true, dormant: true},
+		{expr: `archived == false && (fork || size > 1000)`, active: true, dormant: false},
+		{expr: `true`, active: true, dormant: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			expr, err := CompileExpression(tt.expr)
+			if err != nil {
+				t.Fatalf("CompileExpression() unexpected error = %v", err)
+			}
+			expr.now = func() time.Time { return now }
+
+			if got := expr.Match(active); got != tt.active {
+				t.Errorf("Match(active) = %v, want %v", got, tt.active)
+			}
+			if got := expr.Match(dormant); got != tt.dormant {
+				t.Errorf("Match(dormant) = %v, want %v", got, tt.dormant)
+			}
+		})
+	}
+}
+
+func TestCompileExpressionErrors(t *testing.T) {
+	tests := []struct {
+		expr    string
+		wantErr string
+	}{
+		{expr: `"production" in topcs`, wantErr: `unknown field "topcs" at position 17`},
+		{expr: `size`, wantErr: "expression must be true or false, but it is a number"},
+		{expr: `archived &&`, wantErr: "unexpected end of expression at position 12"},
+		{expr: `archived && size`, wantErr: "&& needs booleans, not boolean and number at position 10"},
+		{expr: `size > "big"`, wantErr: "cannot compare number with string at position 6"},
+		{expr: `name < "m"`, wantErr: "< cannot be used with string values"},
+		{expr: `topics == ["a"]`, wantErr: "cannot compare lists"},
+		{expr: `topics in "production"`, wantErr: "in needs a string and a list or string, not list and string"},
+		{expr: `pushed_at > now() - 365y`, wantErr: `invalid duration unit "y"`},
+		{expr: `name == "unterminated`, wantErr: "unterminated string at position 9"},
+		{expr: `archived & fork`, wantErr: `unexpected character '&'`},
+		{expr: `(archived`, wantErr: `expected ")" but found end of expression`},
+		{expr: `now`, wantErr: `expected "(" but found end of expression`},
+		{expr: `pushed_at + pushed_at > now()`, wantErr: "cannot use + with time and time"},
+		{expr: `language in ["Go", 1]`, wantErr: `lists may only contain strings, found "1"`},
+		{expr: `archived fork`, wantErr: `unexpected "fork" at position 10`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			_, err := CompileExpression(tt.expr)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("CompileExpression() error = %v, expected to contain %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,497 @@
+package client
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	gh "github.com/google/go-github/v57/github"
+)
+
+// topic_match modes
+const (
+	TopicMatchAny = "any"
+	TopicMatchAll = "all"
+)
+
+// Modes for the archived, forks, templates and empty repository filters
+const (
+	AttributeInclude = "include"
+	AttributeExclude = "exclude"
+	AttributeOnly    = "only"
+)
+
+// Orders for the repository listing
+const (
+	SortFullName = "full_name"
+	SortCreated  = "created"
+	SortUpdated  = "updated"
+	SortPushed   = "pushed"
+)
+
+// repositoryVisibilities are the visibilities GitHub reports for repositories
+var repositoryVisibilities = []string{"public", "private", "internal"}
+
+// defaultIncludeTopics is used when include_topics isn't set, so the plugin inventories production repositories as it always has
+var defaultIncludeTopics = []string{"production"}
+
+// RepositoryFilter decides which of an organization's repositories are synced
+type RepositoryFilter struct {
+	// IncludeTopics are required on a repository, all of them or any one depending on TopicMatch.
+	// An empty list selects repositories regardless of topics.
+	IncludeTopics []string
+	// ExcludeTopics drop a repository if it has any of them
+	ExcludeTopics []string
+	TopicMatch    string
+
+	// Archived, Forks, Templates and Empty are AttributeInclude, AttributeExclude or AttributeOnly
+	Archived  string
+	Forks     string
+	Templates string
+	Empty     string
+	// Visibilities allowed; empty allows every visibility
+	Visibilities []string
+
+	// PushedWithin, if non-zero, requires a repository to have been pushed to that recently
+	PushedWithin time.Duration
+	// CreatedAfter, if set, requires a repository to have been created after it
+	CreatedAfter time.Time
+	// Sort is the order repositories are listed in; empty leaves it to GitHub, which lists the newest created first
+	Sort string
+
+	// CustomProperties require a repository to have one of the listed values for each property.
+	// They are matched separately, as custom property values aren't part of the repository listing.
+	CustomProperties map[string][]string
+
+	// IncludeRepos, if set, requires a repository name to match one of them.
+	// ExcludeRepos drop a repository whose name matches any of them.
+	IncludeRepos []NamePattern
+	ExcludeRepos []NamePattern
+
+	// Expression, if set, decides on its own which repositories are synced
+	Expression *Expression
+}
+
+// NamePattern matches repository names with a glob or, if wrapped in slashes, a regular expression
+type NamePattern struct {
+	pattern string
+	glob    string
+	regexp  *regexp.Regexp
+}
+
+// String returns the pattern as it was configured
+func (p NamePattern) String() string {
+	return p.pattern
+}
+
+// Match reports whether the repository name matches the pattern, ignoring case
+func (p NamePattern) Match(name string) bool {
+	if p.regexp != nil {
+		return p.regexp.MatchString(name)
+	}
+	matched, _ := path.Match(p.glob, strings.ToLower(name))
+	return matched
+}
+
+// parseNamePattern compiles a glob such as "archive-*" or a regular expression such as "/^team-(a|b)-/"
+func parseNamePattern(pattern string) (NamePattern, error) {
+	trimmed := strings.TrimSpace(pattern)
+	if trimmed == "" {
+		return NamePattern{}, fmt.Errorf("pattern must not be empty")
+	}
+
+	if len(trimmed) > 1 && strings.HasPrefix(trimmed, "/") && strings.HasSuffix(trimmed, "/") {
+		re, err := regexp.Compile("(?i)" + trimmed[1:len(trimmed)-1])
+		if err != nil {
+			return NamePattern{}, fmt.Errorf("invalid regular expression %s: %w", trimmed, err)
+		}
+		return NamePattern{pattern: trimmed, regexp: re}, nil
+	}
+
+	glob := strings.ToLower(trimmed)
+	if _, err := path.Match(glob, ""); err != nil {
+		return NamePattern{}, fmt.Errorf("invalid glob %s: %w", trimmed, err)
+	}
+	return NamePattern{pattern: trimmed, glob: glob}, nil
+}
+
+// parseNamePatterns compiles each of a list of repository name patterns
+func parseNamePatterns(name string, patterns []string) ([]NamePattern, error) {
+	var parsed []NamePattern
+	for i, pattern := range patterns {
+		p, err := parseNamePattern(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("%s[%d]: %w", name, i, err)
+		}
+		parsed = append(parsed, p)
+	}
+	return parsed, nil
+}
+
+// newRepositoryFilter builds and validates the repository filter from the spec
+func newRepositoryFilter(s *Spec) (RepositoryFilter, error) {
+	sort := strings.ToLower(s.Sort)
+	if sort != "" && !slices.Contains([]string{SortFullName, SortCreated, SortUpdated, SortPushed}, sort) {
+		return RepositoryFilter{}, fmt.Errorf("sort must be %q, %q, %q or %q, got %q", SortFullName, SortCreated, SortUpdated, SortPushed, s.Sort)
+	}
+
+	customProperties, err := parseCustomProperties(s.CustomProperties)
+	if err != nil {
+		return RepositoryFilter{}, err
+	}
+
+	if s.RepoFilter != "" {
+		filter, err := newExpressionFilter(s)
+		filter.Sort = sort
+		filter.CustomProperties = customProperties
+		return filter, err
+	}
+
+	filter := RepositoryFilter{
+		IncludeTopics:    defaultIncludeTopics,
+		TopicMatch:       TopicMatchAny,
+		Sort:             sort,
+		CustomProperties: customProperties,
+	}
+
+	if s.PushedWithin != "" {
+		if filter.PushedWithin, err = parseDuration(s.PushedWithin); err != nil {
+			return RepositoryFilter{}, fmt.Errorf("failed to parse pushed_within: %w", err)
+		}
+		if filter.PushedWithin <= 0 {
+			return RepositoryFilter{}, fmt.Errorf("pushed_within must be positive, got %s", s.PushedWithin)
+		}
+	}
+	if s.CreatedAfter != "" {
+		if filter.CreatedAfter, err = parseDate(s.CreatedAfter); err != nil {
+			return RepositoryFilter{}, fmt.Errorf("failed to parse created_after: %w", err)
+		}
+	}
+
+	// Archived repositories are excluded by default; everything else is included
+	for _, attr := range []struct {
+		name  string
+		value string
+		def   string
+		dest  *string
+	}{
+		{name: "archived", value: s.Archived, def: AttributeExclude, dest: &filter.Archived},
+		{name: "forks", value: s.Forks, def: AttributeInclude, dest: &filter.Forks},
+		{name: "templates", value: s.Templates, def: AttributeInclude, dest: &filter.Templates},
+		{name: "empty", value: s.Empty, def: AttributeInclude, dest: &filter.Empty},
+	} {
+		if *attr.dest, err = parseAttributeMode(attr.name, attr.value, attr.def); err != nil {
+			return RepositoryFilter{}, err
+		}
+	}
+
+	for i, visibility := range s.Visibilities {
+		visibility = strings.ToLower(strings.TrimSpace(visibility))
+		if !slices.Contains(repositoryVisibilities, visibility) {
+			return RepositoryFilter{}, fmt.Errorf("visibilities[%d]: must be one of %s, got %q", i, strings.Join(repositoryVisibilities, ", "), s.Visibilities[i])
+		}
+		filter.Visibilities = append(filter.Visibilities, visibility)
+	}
+
+	if s.IncludeTopics != nil {
+		if filter.IncludeTopics, err = normalizeTopics("include_topics", s.IncludeTopics); err != nil {
+			return RepositoryFilter{}, err
+		}
+	}
+	if filter.ExcludeTopics, err = normalizeTopics("exclude_topics", s.ExcludeTopics); err != nil {
+		return RepositoryFilter{}, err
+	}
+
+	switch strings.ToLower(s.TopicMatch) {
+	case "", TopicMatchAny:
+	case TopicMatchAll:
+		filter.TopicMatch = TopicMatchAll
+	default:
+		return RepositoryFilter{}, fmt.Errorf("topic_match must be %q or %q, got %q", TopicMatchAny, TopicMatchAll, s.TopicMatch)
+	}
+
+	for _, topic := range filter.ExcludeTopics {
+		if slices.Contains(filter.IncludeTopics, topic) {
+			return RepositoryFilter{}, fmt.Errorf("topic %s is in both include_topics and exclude_topics", topic)
+		}
+	}
+
+	if filter.IncludeRepos, err = parseNamePatterns("include_repos", s.IncludeRepos); err != nil {
+		return RepositoryFilter{}, err
+	}
+	if filter.ExcludeRepos, err = parseNamePatterns("exclude_repos", s.ExcludeRepos); err != nil {
+		return RepositoryFilter{}, err
+	}
+	return filter, nil
+}
+
+// newExpressionFilter compiles repo_filter, which can't be combined with the fixed filter options
+func newExpressionFilter(s *Spec) (RepositoryFilter, error) {
+	var conflicting []string
+	for name, set := range map[string]bool{
+		"include_topics": s.IncludeTopics != nil,
+		"exclude_topics": len(s.ExcludeTopics) > 0,
+		"topic_match":    s.TopicMatch != "",
+		"archived":       s.Archived != "",
+		"forks":          s.Forks != "",
+		"templates":      s.Templates != "",
+		"empty":          s.Empty != "",
+		"visibilities":   len(s.Visibilities) > 0,
+		"pushed_within":  s.PushedWithin != "",
+		"created_after":  s.CreatedAfter != "",
+		"include_repos":  len(s.IncludeRepos) > 0,
+		"exclude_repos":  len(s.ExcludeRepos) > 0,
+	} {
+		if set {
+			conflicting = append(conflicting, name)
+		}
+	}
+	if len(conflicting) > 0 {
+		slices.Sort(conflicting)
+		return RepositoryFilter{}, fmt.Errorf("repo_filter cannot be combined with %s - express them in repo_filter instead", strings.Join(conflicting, ", "))
+	}
+
+	expr, err := CompileExpression(s.RepoFilter)
+	if err != nil {
+		return RepositoryFilter{}, fmt.Errorf("invalid repo_filter: %w", err)
+	}
+	return RepositoryFilter{Expression: expr}, nil
+}
+
+// parseCustomProperties checks that each custom property in the filter has at least one value
+func parseCustomProperties(properties map[string][]string) (map[string][]string, error) {
+	if len(properties) == 0 {
+		return nil, nil
+	}
+
+	parsed := make(map[string][]string, len(properties))
+	for name, values := range properties {
+		trimmed := strings.TrimSpace(name)
+		if trimmed == "" {
+			return nil, fmt.Errorf("custom_properties: property name must not be empty")
+		}
+		if len(values) == 0 {
+			return nil, fmt.Errorf("custom_properties.%s: at least one value is required", trimmed)
+		}
+		parsed[trimmed] = values
+	}
+	return parsed, nil
+}
+
+// parseDuration parses a Go duration, or a whole number of days or weeks such as "365d" or "2w"
+func parseDuration(value string) (time.Duration, error) {
+	for suffix, unit := range map[string]time.Duration{"d": 24 * time.Hour, "w": 7 * 24 * time.Hour} {
+		if n, ok := strings.CutSuffix(value, suffix); ok {
+			count, err := strconv.Atoi(n)
+			if err != nil {
+				return 0, fmt.Errorf("invalid duration %q", value)
+			}
+			return time.Duration(count) * unit, nil
+		}
+	}
+	return time.ParseDuration(value)
+}
+
+// parseDate parses a date such as "2024-01-01" or an RFC 3339 time
+func parseDate(value string) (time.Time, error) {
+	if t, err := time.Parse(time.DateOnly, value); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%q must be a date such as 2024-01-01 or an RFC 3339 time", value)
+	}
+	return t, nil
+}
+
+// parseAttributeMode validates an include/exclude/only repository filter, returning def if it isn't set
+func parseAttributeMode(name, value, def string) (string, error) {
+	switch mode := strings.ToLower(value); mode {
+	case "":
+		return def, nil
+	case AttributeInclude, AttributeExclude, AttributeOnly:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("%s must be %q, %q or %q, got %q", name, AttributeInclude, AttributeExclude, AttributeOnly, value)
+	}
+}
+
+// normalizeTopics lower-cases topics to match GitHub, which stores them in lower case
+func normalizeTopics(name string, topics []string) ([]string, error) {
+	normalized := make([]string, 0, len(topics))
+	for i, topic := range topics {
+		topic = strings.ToLower(strings.TrimSpace(topic))
+		if topic == "" {
+			return nil, fmt.Errorf("%s[%d]: topic must not be empty", name, i)
+		}
+		normalized = append(normalized, topic)
+	}
+	return normalized, nil
+}
+
+// Match reports whether the repository should be synced
+func (f RepositoryFilter) Match(repo *gh.Repository) bool {
+	return f.Rejection(repo) == ""
+}
+
+// Rejection returns the spec option that rules the repository out, such as "archived", "exclude_repos",
+// "include_topics" or "repo_filter", or an empty string if the repository should be synced
+func (f RepositoryFilter) Rejection(repo *gh.Repository) string {
+	if f.Expression != nil {
+		if !f.Expression.Match(repo) {
+			return "repo_filter"
+		}
+		return ""
+	}
+
+	var empty *bool
+	if repo.Size != nil {
+		empty = gh.Bool(*repo.Size == 0)
+	}
+
+	switch {
+	case !matchAttribute(f.Archived, repo.Archived):
+		return "archived"
+	case !matchAttribute(f.Forks, repo.Fork):
+		return "forks"
+	case !matchAttribute(f.Templates, repo.IsTemplate):
+		return "templates"
+	case !matchAttribute(f.Empty, empty):
+		return "empty"
+	case !f.matchVisibility(repo):
+		return "visibilities"
+	case !f.matchPushedWithin(repo):
+		return "pushed_within"
+	case !f.matchCreatedAfter(repo):
+		return "created_after"
+	case !f.MatchName(repo):
+		if slices.ContainsFunc(f.ExcludeRepos, func(p NamePattern) bool { return p.Match(repo.GetName()) }) {
+			return "exclude_repos"
+		}
+		return "include_repos"
+	case !f.MatchTopics(repo):
+		if slices.ContainsFunc(f.ExcludeTopics, func(topic string) bool { return slices.Contains(repo.Topics, topic) }) {
+			return "exclude_topics"
+		}
+		return "include_topics"
+	default:
+		return ""
+	}
+}
+
+// matchAttribute applies an include/exclude/only mode to a repository attribute.
+// If GitHub didn't report the attribute, the repository only matches in include mode.
+func matchAttribute(mode string, value *bool) bool {
+	switch mode {
+	case AttributeExclude:
+		return value != nil && !*value
+	case AttributeOnly:
+		return value != nil && *value
+	default:
+		return true
+	}
+}
+
+func (f RepositoryFilter) matchVisibility(repo *gh.Repository) bool {
+	if len(f.Visibilities) == 0 {
+		return true
+	}
+	return slices.Contains(f.Visibilities, repositoryVisibility(repo))
+}
+
+// matchPushedWithin applies pushed_within. Repositories that have never been pushed to are skipped.
+func (f RepositoryFilter) matchPushedWithin(repo *gh.Repository) bool {
+	return f.PushedWithin == 0 || (repo.PushedAt != nil && !repo.PushedAt.Before(time.Now().Add(-f.PushedWithin)))
+}
+
+// matchCreatedAfter applies created_after. Repositories without a creation date are skipped.
+func (f RepositoryFilter) matchCreatedAfter(repo *gh.Repository) bool {
+	return f.CreatedAfter.IsZero() || (repo.CreatedAt != nil && repo.CreatedAt.After(f.CreatedAfter))
+}
+
+// PastWindow reports whether, given the listing order, every repository listed after this one falls
+// outside pushed_within or created_after, so listing can stop
+func (f RepositoryFilter) PastWindow(repo *gh.Repository) bool {
+	switch f.Sort {
+	case SortPushed:
+		return f.PushedWithin > 0 && repo.PushedAt != nil && repo.PushedAt.Before(time.Now().Add(-f.PushedWithin))
+	case SortCreated, "":
+		return !f.CreatedAfter.IsZero() && repo.CreatedAt != nil && !repo.CreatedAt.After(f.CreatedAfter)
+	default:
+		return false
+	}
+}
+
+// repositoryVisibility returns public, private or internal, or an empty string if GitHub didn't report it
+func repositoryVisibility(repo *gh.Repository) string {
+	visibility := repo.GetVisibility()
+	if visibility == "" && repo.Private != nil {
+		// Older GitHub Enterprise Server versions only report whether a repository is private
+		visibility = "public"
+		if *repo.Private {
+			visibility = "private"
+		}
+	}
+	return visibility
+}
+
+// MatchTopics reports whether the repository's topics satisfy the include and exclude lists
+func (f RepositoryFilter) MatchTopics(repo *gh.Repository) bool {
+	for _, topic := range f.ExcludeTopics {
+		if slices.Contains(repo.Topics, topic) {
+			return false
+		}
+	}
+	if len(f.IncludeTopics) == 0 {
+		return true
+	}
+
+	if f.TopicMatch == TopicMatchAll {
+		for _, topic := range f.IncludeTopics {
+			if !slices.Contains(repo.Topics, topic) {
+				return false
+			}
+		}
+		return true
+	}
+	for _, topic := range f.IncludeTopics {
+		if slices.Contains(repo.Topics, topic) {
+			return true
+		}
+	}
+	return false
+}
+
+// MatchName reports whether the repository's name satisfies the include_repos and exclude_repos patterns
+func (f RepositoryFilter) MatchName(repo *gh.Repository) bool {
+	name := repo.GetName()
+	for _, pattern := range f.ExcludeRepos {
+		if pattern.Match(name) {
+			return false
+		}
+	}
+	if len(f.IncludeRepos) == 0 {
+		return true
+	}
+	for _, pattern := range f.IncludeRepos {
+		if pattern.Match(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// MatchCustomProperties reports whether a repository's custom property values, keyed by property name,
+// include one of the filter's values for every property in the filter
+func (f RepositoryFilter) MatchCustomProperties(properties map[string][]string) bool {
+	for name, allowed := range f.CustomProperties {
+		if !slices.ContainsFunc(properties[name], func(value string) bool { return slices.Contains(allowed, value) }) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,442 @@
+package client
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	gh "github.com/google/go-github/v57/github"
+)
+
+func TestNewRepositoryFilter(t *testing.T) {
+	tests := []struct {
+		name    string
+		spec    *Spec
+		want    RepositoryFilter
+		wantErr string
+	}{
+		{
+			name: "defaults to production repositories",
+			spec: &Spec{},
+			want: RepositoryFilter{IncludeTopics: []string{"production"}, ExcludeTopics: []string{}, TopicMatch: TopicMatchAny, Archived: AttributeExclude, Forks: AttributeInclude, Templates: AttributeInclude, Empty: AttributeInclude},
+		},
+		{
+			name: "empty include_topics selects any topics",
+			spec: &Spec{IncludeTopics: []string{}},
+			want: RepositoryFilter{IncludeTopics: []string{}, ExcludeTopics: []string{}, TopicMatch: TopicMatchAny, Archived: AttributeExclude, Forks: AttributeInclude, Templates: AttributeInclude, Empty: AttributeInclude},
+		},
+		{
+			name: "topics are normalized",
+			spec: &Spec{IncludeTopics: []string{" Staging ", "tooling"}, ExcludeTopics: []string{"Deprecated"}, TopicMatch: "ALL"},
+			want: RepositoryFilter{IncludeTopics: []string{"staging", "tooling"}, ExcludeTopics: []string{"deprecated"}, TopicMatch: TopicMatchAll, Archived: AttributeExclude, Forks: AttributeInclude, Templates: AttributeInclude, Empty: AttributeInclude},
+		},
+		{
+			name: "attribute modes and visibilities",
+			spec: &Spec{IncludeTopics: []string{}, Archived: "include", Forks: "Exclude", Templates: "only", Empty: "exclude", Visibilities: []string{"Public", "internal"}},
+			want: RepositoryFilter{
+				IncludeTopics: []string{},
+				ExcludeTopics: []string{},
+				TopicMatch:    TopicMatchAny,
+				Archived:      AttributeInclude,
+				Forks:         AttributeExclude,
+				Templates:     AttributeOnly,
+				Empty:         AttributeExclude,
+				Visibilities:  []string{"public", "internal"},
+			},
+		},
+		{
+			name: "activity window and sort",
+			spec: &Spec{PushedWithin: "365d", CreatedAfter: "2024-01-01", Sort: "Pushed"},
+			want: RepositoryFilter{
+				IncludeTopics: []string{"production"},
+				ExcludeTopics: []string{},
+				TopicMatch:    TopicMatchAny,
+				Archived:      AttributeExclude,
+				Forks:         AttributeInclude,
+				Templates:     AttributeInclude,
+				Empty:         AttributeInclude,
+				PushedWithin:  365 * 24 * time.Hour,
+				CreatedAfter:  time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+				Sort:          SortPushed,
+			},
+		},
+		{
+			name:    "invalid pushed_within",
+			spec:    &Spec{PushedWithin: "a year"},
+			wantErr: "failed to parse pushed_within",
+		},
+		{
+			name:    "negative pushed_within",
+			spec:    &Spec{PushedWithin: "-2w"},
+			wantErr: "pushed_within must be positive",
+		},
+		{
+			name:    "invalid created_after",
+			spec:    &Spec{CreatedAfter: "01/02/2024"},
+			wantErr: `failed to parse created_after: "01/02/2024" must be a date`,
+		},
+		{
+			name:    "invalid sort",
+			spec:    &Spec{Sort: "stars"},
+			wantErr: `sort must be "full_name", "created", "updated" or "pushed", got "stars"`,
+		},
+		{
+			name:    "custom property without values",
+			spec:    &Spec{CustomProperties: map[string][]string{"service-tier": {}}},
+			wantErr: "custom_properties.service-tier: at least one value is required",
+		},
+		{
+			name:    "invalid attribute mode",
+			spec:    &Spec{Forks: "skip"},
+			wantErr: `forks must be "include", "exclude" or "only", got "skip"`,
+		},
+		{
+			name:    "invalid visibility",
+			spec:    &Spec{Visibilities: []string{"public", "secret"}},
+			wantErr: `visibilities[1]: must be one of public, private, internal, got "secret"`,
+		},
+		{
+			name:    "invalid topic_match",
+			spec:    &Spec{TopicMatch: "some"},
+			wantErr: `topic_match must be "any" or "all", got "some"`,
+		},
+		{
+			name:    "empty topic",
+			spec:    &Spec{ExcludeTopics: []string{"deprecated", " "}},
+			wantErr: "exclude_topics[1]: topic must not be empty",
+		},
+		{
+			name:    "invalid glob",
+			spec:    &Spec{ExcludeRepos: []string{"*-sandbox", "archive-["}},
+			wantErr: "exclude_repos[1]: invalid glob archive-[",
+		},
+		{
+			name:    "invalid regular expression",
+			spec:    &Spec{IncludeRepos: []string{"/team-(a|b/"}},
+			wantErr: "include_repos[0]: invalid regular expression /team-(a|b/",
+		},
+		{
+			name:    "empty repo pattern",
+			spec:    &Spec{IncludeRepos: []string{""}},
+			wantErr: "include_repos[0]: pattern must not be empty",
+		},
+		{
+			name:    "repo_filter with fixed filters",
+			spec:    &Spec{RepoFilter: "!archived", Forks: "exclude", IncludeTopics: []string{}},
+			wantErr: "repo_filter cannot be combined with forks, include_topics",
+		},
+		{
+			name:    "invalid repo_filter",
+			spec:    &Spec{RepoFilter: "archived &&"},
+			wantErr: "invalid repo_filter: unexpected end of expression",
+		},
+		{
+			name:    "topic both included and excluded",
+			spec:    &Spec{IncludeTopics: []string{"staging"}, ExcludeTopics: []string{"staging"}},
+			wantErr: "topic staging is in both include_topics and exclude_topics",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := newRepositoryFilter(tt.spec)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("newRepositoryFilter() error = %v, expected to contain %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("newRepositoryFilter() unexpected error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("newRepositoryFilter() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRepositoryFilterMatchExpression(t *testing.T) {
+	filter, err := newRepositoryFilter(&Spec{RepoFilter: `fork || "tooling" in topics`})
+	if err != nil {
+		t.Fatalf("newRepositoryFilter() unexpected error = %v", err)
+	}
+
+	// The expression replaces the default production topic and archived filters
+	tests := []struct {
+		name string
+		repo *gh.Repository
+		want bool
+	}{
+		{name: "archived fork", repo: &gh.Repository{Fork: gh.Bool(true), Archived: gh.Bool(true)}, want: true},
+		{name: "tooling", repo: &gh.Repository{Topics: []string{"tooling"}}, want: true},
+		{name: "production", repo: &gh.Repository{Topics: []string{"production"}, Archived: gh.Bool(false)}, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := filter.Match(tt.repo); got != tt.want {
+				t.Errorf("Match() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRepositoryFilterMatchTopics(t *testing.T) {
+	repo := func(topics ...string) *gh.Repository {
+		return &gh.Repository{Topics: topics}
+	}
+
+	tests := []struct {
+		name   string
+		filter RepositoryFilter
+		repo   *gh.Repository
+		want   bool
+	}{
+		{name: "default matches production", filter: RepositoryFilter{IncludeTopics: []string{"production"}}, repo: repo("production", "api"), want: true},
+		{name: "default skips other topics", filter: RepositoryFilter{IncludeTopics: []string{"production"}}, repo: repo("staging"), want: false},
+		{name: "default skips no topics", filter: RepositoryFilter{IncludeTopics: []string{"production"}}, repo: repo(), want: false},
+		{name: "any matches one of several", filter: RepositoryFilter{IncludeTopics: []string{"production", "staging"}, TopicMatch: TopicMatchAny}, repo: repo("staging"), want: true},
+		{name: "all requires every topic", filter: RepositoryFilter{IncludeTopics: []string{"production", "api"}, TopicMatch: TopicMatchAll}, repo: repo("production"), want: false},
+		{name: "all matches every topic", filter: RepositoryFilter{IncludeTopics: []string{"production", "api"}, TopicMatch: TopicMatchAll}, repo: repo("api", "production", "go"), want: true},
+		{name: "no include topics matches anything", filter: RepositoryFilter{}, repo: repo(), want: true},
+		{name: "exclude drops a repository", filter: RepositoryFilter{ExcludeTopics: []string{"deprecated"}}, repo: repo("tooling", "deprecated"), want: false},
+		{name: "exclude wins over include", filter: RepositoryFilter{IncludeTopics: []string{"production"}, ExcludeTopics: []string{"deprecated"}}, repo: repo("production", "deprecated"), want: false},
+		{name: "exclude with all", filter: RepositoryFilter{IncludeTopics: []string{"production", "api"}, ExcludeTopics: []string{"deprecated"}, TopicMatch: TopicMatchAll}, repo: repo("production", "api"), want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.filter.MatchTopics(tt.repo); got != tt.want {
+				t.Errorf("MatchTopics() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRepositoryFilterMatch(t *testing.T) {
+	anyTopics := RepositoryFilter{
+		IncludeTopics: []string{},
+		Archived:      AttributeInclude,
+		Forks:         AttributeInclude,
+		Templates:     AttributeInclude,
+		Empty:         AttributeInclude,
+	}
+	with := func(change func(f *RepositoryFilter)) RepositoryFilter {
+		f := anyTopics
+		change(&f)
+		return f
+	}
+
+	source := &gh.Repository{Archived: gh.Bool(false), Fork: gh.Bool(false), IsTemplate: gh.Bool(false), Size: gh.Int(120), Visibility: gh.String("private")}
+	archived := &gh.Repository{Archived: gh.Bool(true), Fork: gh.Bool(false), IsTemplate: gh.Bool(false), Size: gh.Int(120), Visibility: gh.String("public")}
+	fork := &gh.Repository{Archived: gh.Bool(false), Fork: gh.Bool(true), IsTemplate: gh.Bool(false), Size: gh.Int(120), Visibility: gh.String("public")}
+	template := &gh.Repository{Archived: gh.Bool(false), Fork: gh.Bool(false), IsTemplate: gh.Bool(true), Size: gh.Int(120), Visibility: gh.String("internal")}
+	empty := &gh.Repository{Archived: gh.Bool(false), Fork: gh.Bool(false), IsTemplate: gh.Bool(false), Size: gh.Int(0), Visibility: gh.String("private")}
+	legacyPublic := &gh.Repository{Archived: gh.Bool(false), Private: gh.Bool(false)}
+
+	tests := []struct {
+		name   string
+		filter RepositoryFilter
+		want   []*gh.Repository
+	}{
+		{name: "include everything", filter: anyTopics, want: []*gh.Repository{source, archived, fork, template, empty, legacyPublic}},
+		{name: "exclude archived", filter: with(func(f *RepositoryFilter) { f.Archived = AttributeExclude }), want: []*gh.Repository{source, fork, template, empty, legacyPublic}},
+		{name: "only archived", filter: with(func(f *RepositoryFilter) { f.Archived = AttributeOnly }), want: []*gh.Repository{archived}},
+		{name: "exclude forks", filter: with(func(f *RepositoryFilter) { f.Forks = AttributeExclude }), want: []*gh.Repository{source, archived, template, empty}},
+		{name: "only templates", filter: with(func(f *RepositoryFilter) { f.Templates = AttributeOnly }), want: []*gh.Repository{template}},
+		{name: "exclude empty", filter: with(func(f *RepositoryFilter) { f.Empty = AttributeExclude }), want: []*gh.Repository{source, archived, fork, template}},
+		{name: "only empty", filter: with(func(f *RepositoryFilter) { f.Empty = AttributeOnly }), want: []*gh.Repository{empty}},
+		{name: "public only", filter: with(func(f *RepositoryFilter) { f.Visibilities = []string{"public"} }), want: []*gh.Repository{archived, fork, legacyPublic}},
+		{name: "private and internal", filter: with(func(f *RepositoryFilter) { f.Visibilities = []string{"private", "internal"} }), want: []*gh.Repository{source, template, empty}},
+		{
+			name: "combined",
+			filter: with(func(f *RepositoryFilter) {
+				f.Archived = AttributeExclude
+				f.Forks = AttributeExclude
+				f.Empty = AttributeExclude
+				f.Visibilities = []string{"private", "internal"}
+			}),
+			want: []*gh.Repository{source, template},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []*gh.Repository
+			for _, repo := range []*gh.Repository{source, archived, fork, template, empty, legacyPublic} {
+				if tt.filter.Match(repo) {
+					got = append(got, repo)
+				}
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Match() selected %d repositories, want %d", len(got), len(tt.want))
+			}
+		})
+	}
+}
+
+func TestRepositoryFilterMatchName(t *testing.T) {
+	patterns := func(raw ...string) []NamePattern {
+		parsed, err := parseNamePatterns("patterns", raw)
+		if err != nil {
+			t.Fatalf("parseNamePatterns() unexpected error = %v", err)
+		}
+		return parsed
+	}
+	repo := func(name string) *gh.Repository {
+		return &gh.Repository{Name: gh.String(name)}
+	}
+
+	tests := []struct {
+		name   string
+		filter RepositoryFilter
+		repo   *gh.Repository
+		want   bool
+	}{
+		{name: "no patterns matches anything", filter: RepositoryFilter{}, repo: repo("service-api"), want: true},
+		{name: "exclude glob suffix", filter: RepositoryFilter{ExcludeRepos: patterns("*-sandbox")}, repo: repo("payments-sandbox"), want: false},
+		{name: "exclude glob prefix", filter: RepositoryFilter{ExcludeRepos: patterns("archive-*", "dependabot-test-*")}, repo: repo("dependabot-test-go"), want: false},
+		{name: "exclude glob ignores case", filter: RepositoryFilter{ExcludeRepos: patterns("archive-*")}, repo: repo("Archive-Frontend"), want: false},
+		{name: "exclude glob keeps other repos", filter: RepositoryFilter{ExcludeRepos: patterns("*-sandbox")}, repo: repo("sandbox-tools"), want: true},
+		{name: "include glob", filter: RepositoryFilter{IncludeRepos: patterns("team-a-*")}, repo: repo("team-a-api"), want: true},
+		{name: "include glob skips others", filter: RepositoryFilter{IncludeRepos: patterns("team-a-*")}, repo: repo("team-b-api"), want: false},
+		{name: "include regexp", filter: RepositoryFilter{IncludeRepos: patterns("/^team-(a|b)-/")}, repo: repo("Team-B-web"), want: true},
+		{name: "exclude wins over include", filter: RepositoryFilter{IncludeRepos: patterns("team-a-*"), ExcludeRepos: patterns("/-sandbox$/")}, repo: repo("team-a-sandbox"), want: false},
+		{name: "missing name matches a wildcard", filter: RepositoryFilter{IncludeRepos: patterns("*")}, repo: &gh.Repository{}, want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.filter.MatchName(tt.repo); got != tt.want {
+				t.Errorf("MatchName() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRepositoryFilterActivity(t *testing.T) {
+	ago := func(d time.Duration) *gh.Timestamp {
+		return &gh.Timestamp{Time: time.Now().Add(-d)}
+	}
+	day := 24 * time.Hour
+	recent := &gh.Repository{PushedAt: ago(10 * day), CreatedAt: ago(100 * day)}
+	dormant := &gh.Repository{PushedAt: ago(500 * day), CreatedAt: ago(1000 * day)}
+	undated := &gh.Repository{}
+
+	tests := []struct {
+		name       string
+		filter     RepositoryFilter
+		repo       *gh.Repository
+		want       bool
+		pastWindow bool
+	}{
+		{name: "no window", filter: RepositoryFilter{Sort: SortPushed}, repo: dormant, want: true},
+		{name: "pushed within", filter: RepositoryFilter{PushedWithin: 365 * day, Sort: SortPushed}, repo: recent, want: true},
+		{name: "pushed too long ago", filter: RepositoryFilter{PushedWithin: 365 * day, Sort: SortPushed}, repo: dormant, want: false, pastWindow: true},
+		{name: "pushed too long ago without sort", filter: RepositoryFilter{PushedWithin: 365 * day}, repo: dormant, want: false},
+		{name: "never pushed", filter: RepositoryFilter{PushedWithin: 365 * day, Sort: SortPushed}, repo: undated, want: false},
+		{name: "created after", filter: RepositoryFilter{CreatedAfter: time.Now().Add(-365 * day), Sort: SortCreated}, repo: recent, want: true},
+		{name: "created before", filter: RepositoryFilter{CreatedAfter: time.Now().Add(-365 * day), Sort: SortCreated}, repo: dormant, want: false, pastWindow: true},
+		{name: "created before in the default order", filter: RepositoryFilter{CreatedAfter: time.Now().Add(-365 * day)}, repo: dormant, want: false, pastWindow: true},
+		{name: "created before sorted by name", filter: RepositoryFilter{CreatedAfter: time.Now().Add(-365 * day), Sort: SortFullName}, repo: dormant, want: false},
+		{name: "created before sorted by push", filter: RepositoryFilter{CreatedAfter: time.Now().Add(-365 * day), Sort: SortPushed}, repo: dormant, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.filter.matchPushedWithin(tt.repo) && tt.filter.matchCreatedAfter(tt.repo); got != tt.want {
+				t.Errorf("matchPushedWithin() && matchCreatedAfter() = %v, want %v", got, tt.want)
+			}
+			if got := tt.filter.PastWindow(tt.repo); got != tt.pastWindow {
+				t.Errorf("PastWindow() = %v, want %v", got, tt.pastWindow)
+			}
+		})
+	}
+}
+
+func TestRepositoryFilterMatchCustomProperties(t *testing.T) {
+	filter := RepositoryFilter{CustomProperties: map[string][]string{
+		"service-tier": {"production", "critical"},
+		"owning-team":  {"platform"},
+	}}
+
+	tests := []struct {
+		name       string
+		properties map[string][]string
+		want       bool
+	}{
+		{name: "every property matches", properties: map[string][]string{"service-tier": {"critical"}, "owning-team": {"platform"}}, want: true},
+		{name: "multi-select value matches", properties: map[string][]string{"service-tier": {"internal", "production"}, "owning-team": {"platform"}}, want: true},
+		{name: "value not allowed", properties: map[string][]string{"service-tier": {"experimental"}, "owning-team": {"platform"}}, want: false},
+		{name: "property missing", properties: map[string][]string{"service-tier": {"production"}}, want: false},
+		{name: "no properties", properties: nil, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := filter.MatchCustomProperties(tt.properties); got != tt.want {
+				t.Errorf("MatchCustomProperties() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	if !(RepositoryFilter{}).MatchCustomProperties(nil) {
+		t.Error("MatchCustomProperties() without custom properties should match every repository")
+	}
+}
+
+func TestRepositoryFilterRejection(t *testing.T) {
+	patterns, err := parseNamePatterns("exclude_repos", []string{"*-sandbox"})
+	if err != nil {
+		t.Fatalf("parseNamePatterns() unexpected error = %v", err)
+	}
+	filter := RepositoryFilter{
+		IncludeTopics: []string{"production"},
+		ExcludeTopics: []string{"deprecated"},
+		Archived:      AttributeExclude,
+		Forks:         AttributeExclude,
+		Visibilities:  []string{"private"},
+		PushedWithin:  365 * 24 * time.Hour,
+		ExcludeRepos:  patterns,
+	}
+	repo := func(change func(r *gh.Repository)) *gh.Repository {
+		r := &gh.Repository{
+			Name:       gh.String("api"),
+			Topics:     []string{"production"},
+			Archived:   gh.Bool(false),
+			Fork:       gh.Bool(false),
+			Visibility: gh.String("private"),
+			PushedAt:   &gh.Timestamp{Time: time.Now()},
+		}
+		change(r)
+		return r
+	}
+
+	tests := []struct {
+		name string
+		repo *gh.Repository
+		want string
+	}{
+		{name: "selected", repo: repo(func(r *gh.Repository) {}), want: ""},
+		{name: "archived", repo: repo(func(r *gh.Repository) { r.Archived = gh.Bool(true) }), want: "archived"},
+		{name: "fork", repo: repo(func(r *gh.Repository) { r.Fork = gh.Bool(true) }), want: "forks"},
+		{name: "public", repo: repo(func(r *gh.Repository) { r.Visibility = gh.String("public") }), want: "visibilities"},
+		{name: "dormant", repo: repo(func(r *gh.Repository) { r.PushedAt = nil }), want: "pushed_within"},
+		{name: "sandbox", repo: repo(func(r *gh.Repository) { r.Name = gh.String("api-sandbox") }), want: "exclude_repos"},
+		{name: "deprecated", repo: repo(func(r *gh.Repository) { r.Topics = []string{"production", "deprecated"} }), want: "exclude_topics"},
+		{name: "missing topic", repo: repo(func(r *gh.Repository) { r.Topics = nil }), want: "include_topics"},
+		{name: "first rule wins", repo: repo(func(r *gh.Repository) { r.Archived = gh.Bool(true); r.Topics = nil }), want: "archived"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := filter.Rejection(tt.repo); got != tt.want {
+				t.Errorf("Rejection() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	expression := RepositoryFilter{Expression: &Expression{root: constant(typeBool, false), now: time.Now}}
+	if got := expression.Rejection(&gh.Repository{}); got != "repo_filter" {
+		t.Errorf("Rejection() with repo_filter = %q, want %q", got, "repo_filter")
+	}
+}
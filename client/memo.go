@@ -0,0 +1,48 @@
+package client
+
+import "sync"
+
+// memo holds values computed once per sync. It is shared by the copies WithOrg makes, so tables
+// multiplexed over the same organization can reuse each other's work.
+type memo struct {
+	mu      sync.Mutex
+	entries map[string]*memoEntry
+}
+
+type memoEntry struct {
+	once  sync.Once
+	value any
+	err   error
+}
+
+// Memoize returns the value fn computed for key earlier in the sync, calling fn if this is the first
+// request for it. Concurrent callers for the same key wait for the first to finish, and errors are
+// remembered like values. Before Connect there's nothing to share, so fn is always called.
+func (c *Client) Memoize(key string, fn func() (any, error)) (any, error) {
+	if c.memo == nil {
+		return fn()
+	}
+
+	c.memo.mu.Lock()
+	entry, ok := c.memo.entries[key]
+	if !ok {
+		entry = &memoEntry{}
+		c.memo.entries[key] = entry
+	}
+	c.memo.mu.Unlock()
+
+	entry.once.Do(func() {
+		entry.value, entry.err = fn()
+	})
+	return entry.value, entry.err
+}
+
+// ResetMemo forgets the values memoized by an earlier sync
+func (c *Client) ResetMemo() {
+	if c.memo == nil {
+		return
+	}
+	c.memo.mu.Lock()
+	defer c.memo.mu.Unlock()
+	c.memo.entries = make(map[string]*memoEntry)
+}
@@ -0,0 +1,68 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+)
+
+func TestMemoize(t *testing.T) {
+	ctx := context.Background()
+	client, err := New(ctx, testLogger(t), &Spec{Orgs: []OrgSpec{{Name: testOrg}, {Name: "other-org"}}, Token: "test-token"})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	calls := 0
+	count := func() (any, error) {
+		calls++
+		return calls, nil
+	}
+
+	if _, err := client.Memoize("selection", count); err != nil {
+		t.Fatalf("Memoize() unexpected error = %v", err)
+	}
+	client.Memoize("selection", count)
+	if calls != 2 {
+		t.Errorf("Memoize() before Connect called fn %d times, want 2", calls)
+	}
+
+	if err := client.Connect(ctx); err != nil {
+		t.Fatalf("Connect() error = %v", err)
+	}
+	calls = 0
+
+	// Copies for each organization share the memo, and fn runs once however many callers race for it
+	var wg sync.WaitGroup
+	for _, org := range client.Orgs {
+		orgClient := client.WithOrg(org)
+		for i := 0; i < 5; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if got, _ := orgClient.Memoize("selection", count); got != 1 {
+					t.Errorf("Memoize() = %v, want 1", got)
+				}
+			}()
+		}
+	}
+	wg.Wait()
+	if calls != 1 {
+		t.Errorf("Memoize() called fn %d times, want 1", calls)
+	}
+
+	wantErr := errors.New("listing failed")
+	failing := func() (any, error) { return nil, wantErr }
+	if _, err := client.Memoize("failing", failing); !errors.Is(err, wantErr) {
+		t.Errorf("Memoize() error = %v, want %v", err, wantErr)
+	}
+	if _, err := client.Memoize("failing", count); !errors.Is(err, wantErr) {
+		t.Errorf("Memoize() error = %v, expected the remembered error", err)
+	}
+
+	client.ResetMemo()
+	if got, _ := client.Memoize("selection", count); got != 2 {
+		t.Errorf("Memoize() after ResetMemo() = %v, want 2", got)
+	}
+}
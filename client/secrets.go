@@ -0,0 +1,160 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/guardian/cq-source-github-languages/internal/github"
+)
+
+// secretCommandTimeout bounds how long a private_key_command may run
+const secretCommandTimeout = 30 * time.Second
+
+// secretSource resolves a secret from wherever it is stored.
+// String describes the source for logging and must never include the secret itself.
+type secretSource interface {
+	Resolve(ctx context.Context) (string, error)
+	String() string
+}
+
+// literalSource is a secret given inline in the spec, either as PEM or base64-encoded PEM
+type literalSource struct {
+	value string
+}
+
+func (s literalSource) Resolve(context.Context) (string, error) {
+	value := strings.TrimSpace(s.value)
+	// Accept base64-encoded PEM without a prefix, as it is often stored that way in CI secrets
+	if value != "" && !strings.Contains(value, "-----BEGIN") {
+		if decoded, err := base64.StdEncoding.DecodeString(value); err == nil && strings.Contains(string(decoded), "-----BEGIN") {
+			return strings.TrimSpace(string(decoded)), nil
+		}
+	}
+	return value, nil
+}
+
+func (s literalSource) String() string {
+	return "config"
+}
+
+// envSource reads a secret from an environment variable
+type envSource struct {
+	name string
+}
+
+func (s envSource) Resolve(ctx context.Context) (string, error) {
+	value, ok := os.LookupEnv(s.name)
+	if !ok {
+		return "", fmt.Errorf("environment variable %s is not set", s.name)
+	}
+	return literalSource{value: value}.Resolve(ctx)
+}
+
+func (s envSource) String() string {
+	return "env:" + s.name
+}
+
+// base64Source decodes a secret given as base64
+type base64Source struct {
+	encoded string
+}
+
+func (s base64Source) Resolve(context.Context) (string, error) {
+	decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(s.encoded))
+	if err != nil {
+		return "", fmt.Errorf("failed to decode base64 secret: %w", err)
+	}
+	return strings.TrimSpace(string(decoded)), nil
+}
+
+func (s base64Source) String() string {
+	return "base64"
+}
+
+// fileSource reads a secret from a file
+type fileSource struct {
+	path string
+}
+
+func (s fileSource) Resolve(context.Context) (string, error) {
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read secret from file %s: %w", s.path, err)
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+func (s fileSource) String() string {
+	return "file:" + s.path
+}
+
+// commandSource runs a command, such as a secret manager CLI, and uses its stdout as the secret
+type commandSource struct {
+	args []string
+}
+
+func (s commandSource) Resolve(ctx context.Context) (string, error) {
+	if len(s.args) == 0 || s.args[0] == "" {
+		return "", fmt.Errorf("secret command is empty")
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, secretCommandTimeout)
+	defer cancel()
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, s.args[0], s.args[1:]...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		// stderr is included to make failures actionable; stdout may hold the secret so is never reported
+		return "", fmt.Errorf("secret command %s failed: %w: %s", s.args[0], err, github.Redact(strings.TrimSpace(stderr.String())))
+	}
+	return strings.TrimSpace(stdout.String()), nil
+}
+
+func (s commandSource) String() string {
+	// Only the executable is reported, as arguments can carry credentials for the secret manager
+	if len(s.args) == 0 {
+		return "command"
+	}
+	return "command:" + s.args[0]
+}
+
+// parseSecretSource interprets an inline secret value, which may refer to another source with
+// an env:, base64: or file: prefix, or with ${file:...} interpolation that was not processed upstream
+func parseSecretSource(value string) secretSource {
+	value = strings.TrimSpace(value)
+	switch {
+	case strings.HasPrefix(value, "env:"):
+		return envSource{name: strings.TrimPrefix(value, "env:")}
+	case strings.HasPrefix(value, "base64:"):
+		return base64Source{encoded: strings.TrimPrefix(value, "base64:")}
+	case strings.HasPrefix(value, "file:"):
+		return fileSource{path: strings.TrimPrefix(value, "file:")}
+	case strings.HasPrefix(value, "${file:") && strings.HasSuffix(value, "}"):
+		return fileSource{path: strings.TrimSuffix(strings.TrimPrefix(value, "${file:"), "}")}
+	default:
+		return literalSource{value: value}
+	}
+}
+
+// privateKeySource picks the configured private key source, in order of precedence:
+// private_key_path, private_key_command, then private_key
+func privateKeySource(s *Spec) secretSource {
+	switch {
+	case s.PrivateKeyPath != "":
+		return fileSource{path: s.PrivateKeyPath}
+	case len(s.PrivateKeyCommand) > 0:
+		return commandSource{args: s.PrivateKeyCommand}
+	case s.PrivateKey != "":
+		return parseSecretSource(s.PrivateKey)
+	default:
+		return nil
+	}
+}
@@ -1,9 +1,103 @@
 package client
 
+import (
+	"encoding/json"
+	"fmt"
+)
+
 type Spec struct {
-	Org            string `json:"org,omitempty"`
-	AppID          string `json:"app_id,omitempty"`
+	Org               string    `json:"org,omitempty"`
+	Orgs              []OrgSpec `json:"orgs,omitempty"`
+	AllInstallations  bool      `json:"all_installations,omitempty"`
+	AppID             string    `json:"app_id,omitempty"`
+	InstallationID    string    `json:"installation_id,omitempty"`
+	PrivateKey        string    `json:"private_key,omitempty"`
+	PrivateKeyPath    string    `json:"private_key_path,omitempty"`
+	PrivateKeyCommand []string  `json:"private_key_command,omitempty"`
+	Token             string    `json:"token,omitempty"`
+	TokenPath         string    `json:"token_path,omitempty"`
+	BaseURL           string    `json:"base_url,omitempty"`
+	UploadURL         string    `json:"upload_url,omitempty"`
+
+	ProxyURL     string `json:"proxy_url,omitempty"`
+	CABundlePath string `json:"ca_bundle_path,omitempty"`
+	// RequestTimeout is a Go duration such as "30s"; it defaults to one minute
+	RequestTimeout string `json:"request_timeout,omitempty"`
+	// InsecureSkipVerify disables TLS certificate verification. Only use it for testing.
+	InsecureSkipVerify bool `json:"insecure_skip_verify,omitempty"`
+
+	// Permissions requested for GitHub App installation tokens, e.g. {"contents": "read"}.
+	// Defaults to read-only metadata and contents.
+	Permissions            map[string]string `json:"permissions,omitempty"`
+	RestrictToRepositories bool              `json:"restrict_to_repositories,omitempty"`
+
+	// IncludeTopics selects repositories by topic. If it isn't set, only repositories with the
+	// production topic are synced; an empty list selects repositories regardless of topics.
+	IncludeTopics []string `json:"include_topics,omitempty"`
+	ExcludeTopics []string `json:"exclude_topics,omitempty"`
+	// TopicMatch is "any" (the default) to require one of include_topics, or "all" to require every one
+	TopicMatch string `json:"topic_match,omitempty"`
+
+	// Archived, Forks, Templates and Empty (size 0) repositories can each be "include"d, "exclude"d or
+	// synced "only". Archived repositories are excluded by default; the others are included.
+	Archived  string `json:"archived,omitempty"`
+	Forks     string `json:"forks,omitempty"`
+	Templates string `json:"templates,omitempty"`
+	Empty     string `json:"empty,omitempty"`
+	// Visibilities limits the sync to public, private and/or internal repositories; empty means all
+	Visibilities []string `json:"visibilities,omitempty"`
+
+	// PushedWithin selects repositories pushed to within a duration such as "365d" or "12h"
+	PushedWithin string `json:"pushed_within,omitempty"`
+	// CreatedAfter selects repositories created after a date such as "2024-01-01", or an RFC 3339 time
+	CreatedAfter string `json:"created_after,omitempty"`
+	// Sort orders the repository listing by "full_name", "created" (GitHub's default), "updated" or "pushed".
+	// Time orders list the newest first, so listing stops early once repositories fall outside the window above.
+	Sort string `json:"sort,omitempty"`
+
+	// IncludeRepos and ExcludeRepos match repository names against glob patterns such as "*-sandbox",
+	// or regular expressions wrapped in slashes such as "/^team-(a|b)-/". Matching ignores case.
+	IncludeRepos []string `json:"include_repos,omitempty"`
+	ExcludeRepos []string `json:"exclude_repos,omitempty"`
+
+	// RepoFilter is a boolean expression over repository fields that replaces the options above, e.g.
+	// "production" in topics && !archived && pushed_at > now() - 365d
+	RepoFilter string `json:"repo_filter,omitempty"`
+
+	// Repositories, given as "owner/name", are fetched individually instead of listing each
+	// organization's repositories. They are synced whatever the repository selection options.
+	Repositories []string `json:"repositories,omitempty"`
+
+	// Teams, given as slugs, limit the sync to the repositories those teams can access in each organization.
+	// TeamPermission optionally requires the team to have at least "push", "maintain" or "admin" access.
+	Teams          []string `json:"teams,omitempty"`
+	TeamPermission string   `json:"team_permission,omitempty"`
+
+	// CustomProperties selects repositories by organization custom property. A repository must have one
+	// of the listed values for every property, e.g. {"service-tier": ["production", "critical"]}.
+	CustomProperties map[string][]string `json:"custom_properties,omitempty"`
+}
+
+// OrgSpec is an entry in the orgs list. It may be given as a plain organization name
+// or as an object with an optional installation_id.
+type OrgSpec struct {
+	Name           string `json:"name,omitempty"`
 	InstallationID string `json:"installation_id,omitempty"`
-	PrivateKey     string `json:"private_key,omitempty"`
-	PrivateKeyPath string `json:"private_key_path,omitempty"`
+}
+
+func (o *OrgSpec) UnmarshalJSON(data []byte) error {
+	var name string
+	if err := json.Unmarshal(data, &name); err == nil {
+		o.Name = name
+		return nil
+	}
+
+	// Alias drops the UnmarshalJSON method so decoding the object form doesn't recurse
+	type orgSpec OrgSpec
+	var obj orgSpec
+	if err := json.Unmarshal(data, &obj); err != nil {
+		return fmt.Errorf("orgs entries must be an organization name or an object with name and installation_id: %w", err)
+	}
+	*o = OrgSpec(obj)
+	return nil
 }
@@ -2,138 +2,381 @@ package github
 
 import (
 	"context"
-	"encoding/pem"
 	"fmt"
 	"net/http"
+	"slices"
+	"strings"
 	"time"
 
-	"github.com/golang-jwt/jwt/v4"
 	"github.com/google/go-github/v57/github"
+	"github.com/rs/zerolog"
 	"golang.org/x/exp/maps"
 	"golang.org/x/oauth2"
 )
 
 type Languages struct {
+	Org string
+	// Teams are the teams the repository was selected through, if teams are configured. They are synced
+	// to github_repository_teams rather than as a column.
+	Teams     []string
 	FullName  string
 	Name      string
 	Languages []string
+	// LanguageBytes is GitHub's count of bytes of code in each language
+	LanguageBytes map[string]int
+	TotalBytes    int64
+}
+
+// RepositoryTeam is a team that selected a repository
+type RepositoryTeam struct {
+	FullName string
+	Team     string
+}
+
+// RepositoryLanguage is one of a repository's languages, ranked by size with 1 the largest
+type RepositoryLanguage struct {
+	FullName   string
+	Language   string
+	Bytes      int
+	Percentage float64
+	Rank       int
+}
+
+// Breakdown returns a RepositoryLanguage per language, largest first. Ties are ordered by name.
+func (l *Languages) Breakdown() []*RepositoryLanguage {
+	breakdown := make([]*RepositoryLanguage, 0, len(l.LanguageBytes))
+	for language, bytes := range l.LanguageBytes {
+		breakdown = append(breakdown, &RepositoryLanguage{FullName: l.FullName, Language: language, Bytes: bytes})
+	}
+	slices.SortFunc(breakdown, func(a, b *RepositoryLanguage) int {
+		if a.Bytes != b.Bytes {
+			return b.Bytes - a.Bytes
+		}
+		return strings.Compare(a.Language, b.Language)
+	})
+
+	for i, language := range breakdown {
+		language.Rank = i + 1
+		if l.TotalBytes > 0 {
+			language.Percentage = float64(language.Bytes) / float64(l.TotalBytes) * 100
+		}
+	}
+	return breakdown
+}
+
+// ExcludedRepository is a repository that was listed but not synced, with the spec option that ruled it out
+type ExcludedRepository struct {
+	Org      string
+	FullName string
+	Name     string
+	Rule     string
+	// Topics are the repository's topics at sync time
+	Topics []string
 }
 
 type Client struct {
 	GitHubClient *github.Client
+	tokenSource  *installationTokenSource
+	opts         Options
+}
+
+// Credentials holds whichever authentication method has been configured.
+// Token takes precedence; otherwise the GitHub App fields are used.
+// If InstallationID is zero, the App's installation on Org is looked up.
+type Credentials struct {
+	Token          string
+	AppID          int64
+	InstallationID int64
+	Org            string
+	PrivateKeyPEM  []byte
+	// Permissions requested for the installation token, e.g. {"metadata": "read"}; empty means all the App has
+	Permissions map[string]string
+}
+
+// Options configures how clients connect to the GitHub API
+type Options struct {
+	// BaseURL points the client at a GitHub Enterprise Server instance; empty means github.com
+	BaseURL string
+	// UploadURL is the GitHub Enterprise Server upload URL; empty means BaseURL
+	UploadURL string
+	// Logger receives an event for each authentication phase; the zero value discards them.
+	// Tokens, JWTs and key material are never logged.
+	Logger zerolog.Logger
+	// ProxyURL routes requests through an HTTP(S) proxy; empty means the proxy environment variables are used
+	ProxyURL string
+	// CABundlePath is a PEM file of additional certificate authorities to trust, e.g. a TLS-intercepting proxy's
+	CABundlePath string
+	// RequestTimeout bounds each HTTP request, including reading the response body; zero means no timeout
+	RequestTimeout time.Duration
+	// InsecureSkipVerify disables TLS certificate verification. It is only for testing.
+	InsecureSkipVerify bool
 }
 
-// NewGitHubAppClient creates a new GitHub client authenticated as a GitHub App installation
-func NewGitHubAppClient(ctx context.Context, appID, installationID int64, privateKeyPEM []byte) (*Client, error) {
-	// Create a new transport using the GitHub App authentication
-	itr, err := newGitHubAppTransport(ctx, appID, installationID, privateKeyPEM)
+// newGitHubClient creates a go-github client for the configured API endpoint
+func newGitHubClient(httpClient *http.Client, opts Options) (*github.Client, error) {
+	client := github.NewClient(httpClient)
+	if opts.BaseURL == "" {
+		return client, nil
+	}
+
+	uploadURL := opts.UploadURL
+	if uploadURL == "" {
+		uploadURL = opts.BaseURL
+	}
+	client, err := client.WithEnterpriseURLs(opts.BaseURL, uploadURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to configure GitHub Enterprise URLs: %w", err)
+	}
+	return client, nil
+}
+
+// NewClientFromCredentials creates a new GitHub client using the configured authentication method
+func NewClientFromCredentials(ctx context.Context, creds Credentials, opts Options) (*Client, error) {
+	if creds.Token != "" {
+		return NewTokenClient(creds.Token, opts)
+	}
+	return NewGitHubAppClient(ctx, creds, opts)
+}
+
+// NewTokenClient creates a new GitHub client authenticated with a personal access token or fine-grained token
+func NewTokenClient(token string, opts Options) (*Client, error) {
+	base, err := newTransport(opts)
 	if err != nil {
 		return nil, err
 	}
+	httpClient := &http.Client{
+		Transport: &oauth2.Transport{
+			Source: oauth2.StaticTokenSource(
+				&oauth2.Token{
+					AccessToken: token,
+					TokenType:   "Bearer",
+				},
+			),
+			Base: base,
+		},
+		Timeout: opts.RequestTimeout,
+	}
 
-	// Create a new client with the transport
-	httpClient := &http.Client{Transport: itr}
-	client := github.NewClient(httpClient)
+	client, err := newGitHubClient(httpClient, opts)
+	if err != nil {
+		return nil, err
+	}
 
 	return &Client{
 		GitHubClient: client,
 	}, nil
 }
 
-// newGitHubAppTransport creates a new http.RoundTripper that authenticates as a GitHub App installation
-func newGitHubAppTransport(ctx context.Context, appID, installationID int64, privateKeyPEM []byte) (http.RoundTripper, error) {
-	privateKey, err := jwt.ParseRSAPrivateKeyFromPEM(privateKeyPEM)
+// NewGitHubAppClient creates a new GitHub client authenticated as a GitHub App installation.
+// If creds.InstallationID is zero, the App's installation on creds.Org is discovered.
+func NewGitHubAppClient(ctx context.Context, creds Credentials, opts Options) (*Client, error) {
+	appClient, err := newAppClient(creds.AppID, creds.PrivateKeyPEM, opts)
 	if err != nil {
-		// Debug: Check if the key looks like a valid PEM key
-		keyStr := string(privateKeyPEM)
-		if len(keyStr) < 100 {
-			return nil, fmt.Errorf("private key appears too short (%d chars) - ensure full key is provided", len(keyStr))
-		}
-		// Use encoding/pem to decode the PEM block
-		block, _ := pem.Decode([]byte(keyStr))
-		if block == nil {
-			return nil, fmt.Errorf("private key is not a valid PEM format: %w", err)
+		return nil, err
+	}
+
+	logger := opts.Logger.With().Int64("app_id", creds.AppID).Str("org", creds.Org).Logger()
+
+	installationID := creds.InstallationID
+	if installationID == 0 {
+		logger.Info().Msg("discovering installation for organization")
+		installationID, err = findOrgInstallation(ctx, appClient, creds.AppID, creds.Org)
+		if err != nil {
+			return nil, err
 		}
-		return nil, fmt.Errorf("failed to parse RSA private key from PEM: %w - ensure key is RSA format and not EC/Ed25519", err)
+		logger.Info().Int64("installation_id", installationID).Msg("found installation for organization")
 	}
 
-	// Create JWT token with proper timing and claims
-	now := time.Now()
-	claims := jwt.MapClaims{
-		"iat": jwt.NewNumericDate(now.Add(-60 * time.Second)), // 1 minute ago to account for clock skew
-		"exp": jwt.NewNumericDate(now.Add(10 * time.Minute)),  // 10 minutes from now (max allowed)
-		"iss": appID,
+	// Mint the first installation token up front so bad credentials fail fast;
+	// the source refreshes it before it expires for the rest of the sync
+	tokenSource := newInstallationTokenSource(appClient, installationID, installationTokenRequest{
+		Permissions: creds.Permissions,
+	}, time.Now, logger)
+	if _, err := tokenSource.Token(); err != nil {
+		return nil, fmt.Errorf("%w - verify App ID (%d) and Installation ID (%d) are correct", err, creds.AppID, installationID)
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	return newInstallationClient(tokenSource, opts)
+}
 
-	signedToken, err := token.SignedString(privateKey)
+// newInstallationClient creates a client that authenticates with the token source's auto-refreshing installation token
+func newInstallationClient(tokenSource *installationTokenSource, opts Options) (*Client, error) {
+	base, err := newTransport(opts)
 	if err != nil {
-		return nil, fmt.Errorf("failed to sign JWT token: %w", err)
+		return nil, err
 	}
-
-	// Debug: Print token claims for debugging
-	fmt.Printf("JWT Claims: iss=%d, iat=%v, exp=%v\n",
-		appID,
-		claims["iat"].(*jwt.NumericDate).Time,
-		claims["exp"].(*jwt.NumericDate).Time)
-
-	// Create an authenticated client for getting an installation token
-	client := github.NewClient(&http.Client{
+	httpClient := &http.Client{
 		Transport: &oauth2.Transport{
-			Source: oauth2.StaticTokenSource(
-				&oauth2.Token{
-					AccessToken: signedToken,
-					TokenType:   "Bearer",
-				},
-			),
+			Source: tokenSource,
+			Base:   base,
 		},
-	})
+		Timeout: opts.RequestTimeout,
+	}
+	client, err := newGitHubClient(httpClient, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Client{
+		GitHubClient: client,
+		tokenSource:  tokenSource,
+		opts:         opts,
+	}, nil
+}
+
+// RestrictToRepositories returns a client whose installation token can only access the given repositories.
+// It is only available for GitHub App authentication.
+func (c *Client) RestrictToRepositories(repositoryIDs []int64) (*Client, error) {
+	if c.tokenSource == nil {
+		return nil, fmt.Errorf("only GitHub App installation tokens can be restricted to repositories")
+	}
+	if len(repositoryIDs) > MaxTokenRepositories {
+		return nil, fmt.Errorf("installation tokens can be restricted to at most %d repositories, got %d", MaxTokenRepositories, len(repositoryIDs))
+	}
+
+	tokenSource := c.tokenSource.withRepositories(repositoryIDs)
+	if _, err := tokenSource.Token(); err != nil {
+		return nil, err
+	}
+	return newInstallationClient(tokenSource, c.opts)
+}
+
+// GrantedPermissions returns the permissions GitHub granted the current installation token.
+// It returns nil for token authentication, where the granted permissions aren't known.
+func (c *Client) GrantedPermissions() map[string]string {
+	if c.tokenSource == nil {
+		return nil
+	}
+	return c.tokenSource.grantedPermissions()
+}
+
+// newAppClient creates a go-github client that authenticates as the GitHub App itself
+func newAppClient(appID int64, privateKeyPEM []byte, opts Options) (*github.Client, error) {
+	privateKey, err := ParsePrivateKey(privateKeyPEM)
+	if err != nil {
+		return nil, err
+	}
+
+	base, err := newTransport(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	// Every request is signed with a fresh JWT
+	appTransport := &appJWTTransport{
+		appID:      appID,
+		privateKey: privateKey,
+		now:        time.Now,
+		base:       base,
+		logger:     opts.Logger,
+	}
+	if _, err := appTransport.signJWT(); err != nil {
+		return nil, err
+	}
+	return newGitHubClient(&http.Client{Transport: appTransport, Timeout: opts.RequestTimeout}, opts)
+}
 
-	// Test the JWT token first by trying to list app installations
-	fmt.Printf("Testing JWT token by listing app installations...\n")
-	installations, _, err := client.Apps.ListInstallations(ctx, nil)
+// Installation is an organization the GitHub App is installed on
+type Installation struct {
+	ID  int64
+	Org string
+}
+
+// ListOrgInstallations lists the organizations the GitHub App is installed on, authenticating with the App JWT.
+// Installations on user accounts are skipped.
+func ListOrgInstallations(ctx context.Context, appID int64, privateKeyPEM []byte, opts Options) ([]Installation, error) {
+	client, err := newAppClient(appID, privateKeyPEM, opts)
 	if err != nil {
-		return nil, fmt.Errorf("JWT token validation failed when listing installations: %w - check App ID (%d) and private key", err, appID)
+		return nil, err
 	}
-	fmt.Printf("JWT token valid - found %d installations\n", len(installations))
 
-	// Get installation token with timeout context
-	timeoutCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
-	defer cancel()
+	listOpts := &github.ListOptions{PerPage: 100}
+	var installations []Installation
+	for {
+		page, resp, err := client.Apps.ListInstallations(ctx, listOpts)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list installations: %w - check App ID (%d) and private key", err, appID)
+		}
+
+		for _, inst := range page {
+			if inst.GetAccount().GetType() != "Organization" {
+				continue
+			}
+			installations = append(installations, Installation{
+				ID:  inst.GetID(),
+				Org: inst.GetAccount().GetLogin(),
+			})
+		}
 
-	fmt.Printf("Attempting to create installation token for installation ID: %d\n", installationID)
+		if resp.NextPage == 0 {
+			break
+		}
+		listOpts.Page = resp.NextPage
+	}
+	return installations, nil
+}
+
+// VerifyApp checks that GitHub accepts JWTs signed with the private key as authenticating the App
+func VerifyApp(ctx context.Context, appID int64, privateKeyPEM []byte, opts Options) error {
+	client, err := newAppClient(appID, privateKeyPEM, opts)
+	if err != nil {
+		return err
+	}
+
+	if _, _, err := client.Apps.Get(ctx, ""); err != nil {
+		return fmt.Errorf("GitHub did not accept the App JWT: %w - check App ID (%d) matches the private key and the key has not been revoked", err, appID)
+	}
+	return nil
+}
 
-	installToken, resp, err := client.Apps.CreateInstallationToken(
-		timeoutCtx,
-		installationID,
-		&github.InstallationTokenOptions{},
-	)
+// FindInstallation returns the App's installation on org. If installationID is set, that installation
+// is fetched and must belong to org; otherwise the installation is looked up from the organization.
+func FindInstallation(ctx context.Context, appID int64, privateKeyPEM []byte, org string, installationID int64, opts Options) (Installation, error) {
+	client, err := newAppClient(appID, privateKeyPEM, opts)
 	if err != nil {
-		// Provide more detailed error information
-		if resp != nil {
-			return nil, fmt.Errorf("failed to create installation token (HTTP %d): %w - verify App ID (%d) and Installation ID (%d) are correct",
-				resp.StatusCode, err, appID, installationID)
+		return Installation{}, err
+	}
+
+	if installationID == 0 {
+		id, err := findOrgInstallation(ctx, client, appID, org)
+		if err != nil {
+			return Installation{}, err
 		}
-		return nil, fmt.Errorf("failed to create installation token: %w - verify App ID (%d) and Installation ID (%d) are correct",
-			err, appID, installationID)
+		return Installation{ID: id, Org: org}, nil
 	}
 
-	if installToken == nil || installToken.Token == nil {
-		return nil, fmt.Errorf("received nil installation token")
+	installation, resp, err := client.Apps.GetInstallation(ctx, installationID)
+	if err != nil {
+		if resp != nil && resp.StatusCode == http.StatusNotFound {
+			return Installation{}, fmt.Errorf("installation %d of GitHub App %d was not found - check installation_id", installationID, appID)
+		}
+		return Installation{}, fmt.Errorf("failed to get installation %d: %w", installationID, err)
 	}
 
-	fmt.Printf("Successfully created installation token (expires: %v)\n", installToken.ExpiresAt)
+	login := installation.GetAccount().GetLogin()
+	if !strings.EqualFold(login, org) {
+		return Installation{}, fmt.Errorf("installation %d belongs to %s, not organization %s - check installation_id", installationID, login, org)
+	}
+	return Installation{ID: installationID, Org: login}, nil
+}
 
-	// Return transport that uses the installation token
-	return &oauth2.Transport{
-		Source: oauth2.StaticTokenSource(
-			&oauth2.Token{
-				AccessToken: *installToken.Token,
-				TokenType:   "token",
-			},
-		),
-	}, nil
+// findOrgInstallation looks up the ID of the App's installation on org using the App JWT
+func findOrgInstallation(ctx context.Context, appClient *github.Client, appID int64, org string) (int64, error) {
+	if org == "" {
+		return 0, fmt.Errorf("organization is required to discover the installation ID")
+	}
+
+	installation, resp, err := appClient.Apps.FindOrganizationInstallation(ctx, org)
+	if err != nil {
+		if resp != nil && resp.StatusCode == http.StatusNotFound {
+			return 0, fmt.Errorf("GitHub App %d is not installed on organization %s - install the App or set installation_id", appID, org)
+		}
+		return 0, fmt.Errorf("failed to find installation for organization %s: %w - check App ID (%d) and private key", org, err, appID)
+	}
+	if installation == nil || installation.ID == nil {
+		return 0, fmt.Errorf("received installation without an ID for organization %s", org)
+	}
+	return *installation.ID, nil
 }
 
 func (c *Client) GetLanguages(ctx context.Context, owner string, name string) (*Languages, error) {
@@ -142,9 +385,13 @@ func (c *Client) GetLanguages(ctx context.Context, owner string, name string) (*
 		return nil, err
 	}
 	l := &Languages{
-		FullName:  owner + "/" + name,
-		Name:      name,
-		Languages: maps.Keys(langs),
+		FullName:      owner + "/" + name,
+		Name:          name,
+		Languages:     maps.Keys(langs),
+		LanguageBytes: langs,
+	}
+	for _, bytes := range langs {
+		l.TotalBytes += int64(bytes)
 	}
 	return l, nil
 
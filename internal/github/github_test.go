@@ -2,7 +2,11 @@ package github
 
 import (
 	"context"
+	"crypto/rsa"
+	"crypto/x509"
 	"encoding/json"
+	"encoding/pem"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
@@ -18,8 +22,13 @@ MIIEpAIBAAKCAQEA1234567890abcdef...
 -----END RSA PRIVATE KEY-----`
 	testAppID          = int64(12345) // int64 - matches API layer
 	testInstallationID = int64(67890) // int64 - matches API layer
+	testOrg            = "test-org"
 )
 
+func encodeTestKey(key *rsa.PrivateKey) []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+}
+
 func TestClient_GetLanguages(t *testing.T) {
 	// Mock GitHub API server
 	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -86,6 +95,41 @@ func TestClient_GetLanguages(t *testing.T) {
 			t.Errorf("Expected language %s not found in result", expectedLang)
 		}
 	}
+
+	if result.LanguageBytes["Go"] != 12345 || result.LanguageBytes["Python"] != 3456 {
+		t.Errorf("LanguageBytes = %v, want the byte counts from GitHub", result.LanguageBytes)
+	}
+	if result.TotalBytes != 12345+6789+3456 {
+		t.Errorf("TotalBytes = %d, want %d", result.TotalBytes, 12345+6789+3456)
+	}
+}
+
+func TestLanguagesBreakdown(t *testing.T) {
+	langs := &Languages{
+		FullName:      "testowner/testrepo",
+		LanguageBytes: map[string]int{"Scala": 900, "Shell": 50, "Dockerfile": 50},
+		TotalBytes:    1000,
+	}
+
+	got := langs.Breakdown()
+	want := []*RepositoryLanguage{
+		{FullName: "testowner/testrepo", Language: "Scala", Bytes: 900, Percentage: 90, Rank: 1},
+		{FullName: "testowner/testrepo", Language: "Dockerfile", Bytes: 50, Percentage: 5, Rank: 2},
+		{FullName: "testowner/testrepo", Language: "Shell", Bytes: 50, Percentage: 5, Rank: 3},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("Breakdown() returned %d languages, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if *got[i] != *want[i] {
+			t.Errorf("Breakdown()[%d] = %+v, want %+v", i, *got[i], *want[i])
+		}
+	}
+
+	empty := (&Languages{LanguageBytes: map[string]int{"Go": 0}}).Breakdown()
+	if len(empty) != 1 || empty[0].Percentage != 0 || empty[0].Rank != 1 {
+		t.Errorf("Breakdown() with no bytes = %+v, want Go ranked 1 at 0%%", empty[0])
+	}
 }
 
 func TestClient_GetLanguagesError(t *testing.T) {
@@ -130,7 +174,7 @@ func TestNewGitHubAppClient(t *testing.T) {
 			installationID: testInstallationID,
 			privateKey:     []byte(""),
 			wantErr:        true,
-			expectedErrMsg: "appears too short",
+			expectedErrMsg: "must be in PEM format",
 		},
 		{
 			name:           "invalid PEM format",
@@ -138,7 +182,7 @@ func TestNewGitHubAppClient(t *testing.T) {
 			installationID: testInstallationID,
 			privateKey:     []byte("not-pem-data"),
 			wantErr:        true,
-			expectedErrMsg: "appears too short",
+			expectedErrMsg: "must be in PEM format",
 		},
 		{
 			name:           "empty PEM block",
@@ -146,7 +190,7 @@ func TestNewGitHubAppClient(t *testing.T) {
 			installationID: testInstallationID,
 			privateKey:     []byte("-----BEGIN CERTIFICATE-----\n-----END CERTIFICATE-----"),
 			wantErr:        true,
-			expectedErrMsg: "appears too short",
+			expectedErrMsg: "unsupported PEM block type \"CERTIFICATE\"",
 		},
 		{
 			name:           "short key",
@@ -154,21 +198,26 @@ func TestNewGitHubAppClient(t *testing.T) {
 			installationID: testInstallationID,
 			privateKey:     []byte("short"),
 			wantErr:        true,
-			expectedErrMsg: "appears too short",
+			expectedErrMsg: "must be in PEM format",
 		},
 		{
-			name:           "dummy RSA key (valid PEM, invalid RSA)",
+			name:           "dummy RSA key (invalid base64 body)",
 			appID:          testAppID,
 			installationID: testInstallationID,
 			privateKey:     []byte(dummyRSAKey),
 			wantErr:        true,
-			expectedErrMsg: "appears too short",
+			expectedErrMsg: "must be in PEM format",
 		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			_, err := NewGitHubAppClient(ctx, tt.appID, tt.installationID, tt.privateKey)
+			_, err := NewGitHubAppClient(ctx, Credentials{
+				AppID:          tt.appID,
+				InstallationID: tt.installationID,
+				Org:            testOrg,
+				PrivateKeyPEM:  tt.privateKey,
+			}, Options{})
 			if tt.wantErr {
 				if err == nil {
 					t.Error("expected error but got none")
@@ -184,3 +233,253 @@ func TestNewGitHubAppClient(t *testing.T) {
 		})
 	}
 }
+
+func TestNewTokenClient(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got := r.Header.Get("Authorization"); got != "Bearer test-token" {
+			t.Errorf("Authorization = %q, want %q", got, "Bearer test-token")
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if _, err := w.Write([]byte(`{"Go": 100}`)); err != nil {
+			t.Errorf("Failed to write response: %v", err)
+		}
+	}))
+	defer server.Close()
+
+	client, err := NewTokenClient("test-token", Options{})
+	if err != nil {
+		t.Fatalf("NewTokenClient() error = %v", err)
+	}
+	client.GitHubClient.BaseURL, _ = url.Parse(server.URL + "/")
+
+	result, err := client.GetLanguages(context.Background(), "testowner", "testrepo")
+	if err != nil {
+		t.Fatalf("GetLanguages() error = %v", err)
+	}
+	if len(result.Languages) != 1 || result.Languages[0] != "Go" {
+		t.Errorf("Languages = %v, want [Go]", result.Languages)
+	}
+}
+
+func TestNewClientFromCredentials(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("token is used when configured", func(t *testing.T) {
+		client, err := NewClientFromCredentials(ctx, Credentials{Token: "test-token"}, Options{})
+		if err != nil {
+			t.Fatalf("unexpected error = %v", err)
+		}
+		if client.GitHubClient == nil {
+			t.Error("GitHubClient should not be nil")
+		}
+	})
+
+	t.Run("app credentials are used without a token", func(t *testing.T) {
+		_, err := NewClientFromCredentials(ctx, Credentials{
+			AppID:          testAppID,
+			InstallationID: testInstallationID,
+			PrivateKeyPEM:  []byte(dummyRSAKey),
+		}, Options{})
+		if err == nil || !strings.Contains(err.Error(), "must be in PEM format") {
+			t.Errorf("error = %v, expected app key parsing error", err)
+		}
+	})
+}
+
+func TestEnterpriseBaseURL(t *testing.T) {
+	keyPEM := encodeTestKey(generateTestKey(t))
+
+	// GitHub Enterprise Server serves the REST API under /api/v3/
+	mux := http.NewServeMux()
+	mux.HandleFunc(fmt.Sprintf("/api/v3/app/installations/%d/access_tokens", testInstallationID), func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.Header.Get("Authorization"), "Bearer ") {
+			t.Errorf("token exchange should be authenticated with the App JWT")
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		if _, err := w.Write([]byte(`{"token": "ghes-token", "expires_at": "2099-01-01T00:00:00Z"}`)); err != nil {
+			t.Errorf("Failed to write response: %v", err)
+		}
+	})
+	mux.HandleFunc("/api/v3/repos/testowner/testrepo/languages", func(w http.ResponseWriter, r *http.Request) {
+		if got := r.Header.Get("Authorization"); got != "token ghes-token" {
+			t.Errorf("Authorization = %q, want %q", got, "token ghes-token")
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if _, err := w.Write([]byte(`{"Scala": 100}`)); err != nil {
+			t.Errorf("Failed to write response: %v", err)
+		}
+	})
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("unexpected request to %s", r.URL.Path)
+		w.WriteHeader(http.StatusNotFound)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	ctx := context.Background()
+	opts := Options{BaseURL: server.URL}
+
+	t.Run("github app", func(t *testing.T) {
+		client, err := NewGitHubAppClient(ctx, Credentials{
+			AppID:          testAppID,
+			InstallationID: testInstallationID,
+			Org:            testOrg,
+			PrivateKeyPEM:  keyPEM,
+		}, opts)
+		if err != nil {
+			t.Fatalf("NewGitHubAppClient() error = %v", err)
+		}
+		if got, want := client.GitHubClient.BaseURL.String(), server.URL+"/api/v3/"; got != want {
+			t.Errorf("BaseURL = %v, want %v", got, want)
+		}
+		if got, want := client.GitHubClient.UploadURL.String(), server.URL+"/api/uploads/"; got != want {
+			t.Errorf("UploadURL = %v, want %v", got, want)
+		}
+
+		result, err := client.GetLanguages(ctx, "testowner", "testrepo")
+		if err != nil {
+			t.Fatalf("GetLanguages() error = %v", err)
+		}
+		if len(result.Languages) != 1 || result.Languages[0] != "Scala" {
+			t.Errorf("Languages = %v, want [Scala]", result.Languages)
+		}
+	})
+
+	t.Run("explicit upload url", func(t *testing.T) {
+		client, err := NewTokenClient("test-token", Options{BaseURL: server.URL, UploadURL: "https://uploads.example.com/"})
+		if err != nil {
+			t.Fatalf("NewTokenClient() error = %v", err)
+		}
+		if got, want := client.GitHubClient.UploadURL.String(), "https://uploads.example.com/api/uploads/"; got != want {
+			t.Errorf("UploadURL = %v, want %v", got, want)
+		}
+	})
+
+	t.Run("invalid base url", func(t *testing.T) {
+		_, err := NewTokenClient("test-token", Options{BaseURL: "://bad"})
+		if err == nil || !strings.Contains(err.Error(), "failed to configure GitHub Enterprise URLs") {
+			t.Errorf("error = %v, expected enterprise URL error", err)
+		}
+	})
+}
+
+func TestInstallationDiscovery(t *testing.T) {
+	keyPEM := encodeTestKey(generateTestKey(t))
+	ctx := context.Background()
+
+	newServer := func(installed bool) *httptest.Server {
+		mux := http.NewServeMux()
+		mux.HandleFunc("/api/v3/orgs/"+testOrg+"/installation", func(w http.ResponseWriter, r *http.Request) {
+			if !strings.HasPrefix(r.Header.Get("Authorization"), "Bearer ") {
+				t.Errorf("installation lookup should be authenticated with the App JWT")
+			}
+			if !installed {
+				w.WriteHeader(http.StatusNotFound)
+				if _, err := w.Write([]byte(`{"message": "Not Found"}`)); err != nil {
+					t.Errorf("Failed to write response: %v", err)
+				}
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			if _, err := w.Write([]byte(`{"id": 67890}`)); err != nil {
+				t.Errorf("Failed to write response: %v", err)
+			}
+		})
+		mux.HandleFunc(fmt.Sprintf("/api/v3/app/installations/%d/access_tokens", testInstallationID), func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusCreated)
+			if _, err := w.Write([]byte(`{"token": "discovered-token", "expires_at": "2099-01-01T00:00:00Z"}`)); err != nil {
+				t.Errorf("Failed to write response: %v", err)
+			}
+		})
+		return httptest.NewServer(mux)
+	}
+
+	t.Run("installation found", func(t *testing.T) {
+		server := newServer(true)
+		defer server.Close()
+
+		client, err := NewClientFromCredentials(ctx, Credentials{
+			AppID:         testAppID,
+			Org:           testOrg,
+			PrivateKeyPEM: keyPEM,
+		}, Options{BaseURL: server.URL})
+		if err != nil {
+			t.Fatalf("NewClientFromCredentials() error = %v", err)
+		}
+		if client.GitHubClient == nil {
+			t.Error("GitHubClient should not be nil")
+		}
+	})
+
+	t.Run("app not installed on org", func(t *testing.T) {
+		server := newServer(false)
+		defer server.Close()
+
+		_, err := NewClientFromCredentials(ctx, Credentials{
+			AppID:         testAppID,
+			Org:           testOrg,
+			PrivateKeyPEM: keyPEM,
+		}, Options{BaseURL: server.URL})
+		if err == nil {
+			t.Fatal("expected error but got none")
+		}
+		if !strings.Contains(err.Error(), "is not installed on organization test-org") {
+			t.Errorf("error = %v, expected to explain the App is not installed", err)
+		}
+	})
+
+	t.Run("org required for discovery", func(t *testing.T) {
+		_, err := NewClientFromCredentials(ctx, Credentials{
+			AppID:         testAppID,
+			PrivateKeyPEM: keyPEM,
+		}, Options{})
+		if err == nil || !strings.Contains(err.Error(), "organization is required") {
+			t.Errorf("error = %v, expected organization to be required", err)
+		}
+	})
+}
+
+func TestListOrgInstallations(t *testing.T) {
+	keyPEM := encodeTestKey(generateTestKey(t))
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v3/app/installations" {
+			t.Errorf("unexpected request to %s", r.URL.Path)
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if !strings.HasPrefix(r.Header.Get("Authorization"), "Bearer ") {
+			t.Errorf("listing installations should be authenticated with the App JWT")
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		body := `[{"id": 1, "account": {"login": "org-a", "type": "Organization"}},
+			{"id": 2, "account": {"login": "some-user", "type": "User"}}]`
+		if r.URL.Query().Get("page") == "2" {
+			body = `[{"id": 3, "account": {"login": "org-b", "type": "Organization"}}]`
+		} else {
+			w.Header().Set("Link", fmt.Sprintf(`<%s/api/v3/app/installations?page=2>; rel="next"`, "http://"+r.Host))
+		}
+		if _, err := w.Write([]byte(body)); err != nil {
+			t.Errorf("Failed to write response: %v", err)
+		}
+	}))
+	defer server.Close()
+
+	installations, err := ListOrgInstallations(context.Background(), testAppID, keyPEM, Options{BaseURL: server.URL})
+	if err != nil {
+		t.Fatalf("ListOrgInstallations() error = %v", err)
+	}
+
+	want := []Installation{{ID: 1, Org: "org-a"}, {ID: 3, Org: "org-b"}}
+	if len(installations) != len(want) {
+		t.Fatalf("installations = %v, want %v", installations, want)
+	}
+	for i := range want {
+		if installations[i] != want[i] {
+			t.Errorf("installations[%d] = %v, want %v", i, installations[i], want[i])
+		}
+	}
+}
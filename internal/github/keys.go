@@ -0,0 +1,67 @@
+package github
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+)
+
+// ParsePrivateKey parses a GitHub App private key in PEM format.
+// Both PKCS#1 ("RSA PRIVATE KEY") and PKCS#8 ("PRIVATE KEY") encodings are accepted, but the key must be RSA.
+func ParsePrivateKey(privateKeyPEM []byte) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode(privateKeyPEM)
+	if block == nil {
+		return nil, fmt.Errorf("private key must be in PEM format with proper BEGIN/END markers")
+	}
+
+	//nolint:staticcheck // legacy encrypted PEM is detected only to report it clearly
+	if x509.IsEncryptedPEMBlock(block) || block.Type == "ENCRYPTED PRIVATE KEY" {
+		return nil, fmt.Errorf("private key is encrypted - provide the unencrypted key downloaded from the GitHub App settings")
+	}
+
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		key, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse PKCS#1 RSA private key: %w", err)
+		}
+		return key, nil
+	case "PRIVATE KEY":
+		parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse PKCS#8 private key: %w", err)
+		}
+		switch key := parsed.(type) {
+		case *rsa.PrivateKey:
+			return key, nil
+		case *ecdsa.PrivateKey:
+			return nil, fmt.Errorf("PKCS#8 private key is ECDSA - GitHub Apps require an RSA key")
+		case ed25519.PrivateKey:
+			return nil, fmt.Errorf("PKCS#8 private key is Ed25519 - GitHub Apps require an RSA key")
+		default:
+			return nil, fmt.Errorf("PKCS#8 private key is %T - GitHub Apps require an RSA key", parsed)
+		}
+	case "EC PRIVATE KEY":
+		return nil, fmt.Errorf("private key is an EC key - GitHub Apps require an RSA key")
+	case "OPENSSH PRIVATE KEY":
+		return nil, fmt.Errorf("private key is in OpenSSH format - use the PEM key downloaded from the GitHub App settings")
+	default:
+		return nil, fmt.Errorf("unsupported PEM block type %q - expected %q (PKCS#1) or %q (PKCS#8)", block.Type, "RSA PRIVATE KEY", "PRIVATE KEY")
+	}
+}
+
+// PublicKeyFingerprint returns the SHA-256 fingerprint of the key's public half, in the same
+// "SHA256:..." form GitHub shows in the App settings. It is safe to log.
+func PublicKeyFingerprint(key *rsa.PrivateKey) (string, error) {
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal public key: %w", err)
+	}
+	sum := sha256.Sum256(der)
+	return "SHA256:" + base64.StdEncoding.EncodeToString(sum[:]), nil
+}
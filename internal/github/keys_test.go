@@ -0,0 +1,116 @@
+package github
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"strings"
+	"testing"
+)
+
+func TestParsePrivateKey(t *testing.T) {
+	rsaKey := generateTestKey(t)
+
+	pkcs8RSA, err := x509.MarshalPKCS8PrivateKey(rsaKey)
+	if err != nil {
+		t.Fatalf("failed to marshal PKCS#8 key: %v", err)
+	}
+
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate EC key: %v", err)
+	}
+	pkcs8EC, err := x509.MarshalPKCS8PrivateKey(ecKey)
+	if err != nil {
+		t.Fatalf("failed to marshal PKCS#8 EC key: %v", err)
+	}
+	ecDER, err := x509.MarshalECPrivateKey(ecKey)
+	if err != nil {
+		t.Fatalf("failed to marshal EC key: %v", err)
+	}
+
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate Ed25519 key: %v", err)
+	}
+	pkcs8Ed, err := x509.MarshalPKCS8PrivateKey(edKey)
+	if err != nil {
+		t.Fatalf("failed to marshal PKCS#8 Ed25519 key: %v", err)
+	}
+
+	encode := func(blockType string, der []byte) []byte {
+		return pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der})
+	}
+
+	tests := []struct {
+		name    string
+		pem     []byte
+		wantErr string
+	}{
+		{name: "PKCS#1 RSA", pem: encodeTestKey(rsaKey)},
+		{name: "PKCS#8 RSA", pem: encode("PRIVATE KEY", pkcs8RSA)},
+		{name: "not PEM", pem: []byte("not-pem-data"), wantErr: "must be in PEM format"},
+		{name: "PKCS#8 ECDSA", pem: encode("PRIVATE KEY", pkcs8EC), wantErr: "PKCS#8 private key is ECDSA"},
+		{name: "PKCS#8 Ed25519", pem: encode("PRIVATE KEY", pkcs8Ed), wantErr: "PKCS#8 private key is Ed25519"},
+		{name: "SEC 1 EC", pem: encode("EC PRIVATE KEY", ecDER), wantErr: "private key is an EC key"},
+		{name: "OpenSSH", pem: encode("OPENSSH PRIVATE KEY", []byte("openssh")), wantErr: "OpenSSH format"},
+		{name: "encrypted PKCS#8", pem: encode("ENCRYPTED PRIVATE KEY", []byte("encrypted")), wantErr: "private key is encrypted"},
+		{name: "certificate", pem: encode("CERTIFICATE", []byte("cert")), wantErr: `unsupported PEM block type "CERTIFICATE"`},
+		{name: "corrupt PKCS#1", pem: encode("RSA PRIVATE KEY", []byte("corrupt")), wantErr: "failed to parse PKCS#1 RSA private key"},
+		{name: "corrupt PKCS#8", pem: encode("PRIVATE KEY", []byte("corrupt")), wantErr: "failed to parse PKCS#8 private key"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key, err := ParsePrivateKey(tt.pem)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("ParsePrivateKey() error = %v, expected to contain %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParsePrivateKey() unexpected error = %v", err)
+			}
+			if !key.Equal(rsaKey) {
+				t.Error("ParsePrivateKey() returned a different key")
+			}
+		})
+	}
+}
+
+func TestPublicKeyFingerprint(t *testing.T) {
+	key := generateTestKey(t)
+
+	fingerprint, err := PublicKeyFingerprint(key)
+	if err != nil {
+		t.Fatalf("PublicKeyFingerprint() error = %v", err)
+	}
+
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatalf("failed to marshal public key: %v", err)
+	}
+	sum := sha256.Sum256(der)
+	if want := "SHA256:" + base64.StdEncoding.EncodeToString(sum[:]); fingerprint != want {
+		t.Errorf("PublicKeyFingerprint() = %v, want %v", fingerprint, want)
+	}
+
+	// The same key encoded as PKCS#1 or PKCS#8 has the same fingerprint
+	pkcs8, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatalf("failed to marshal PKCS#8 key: %v", err)
+	}
+	parsed, err := ParsePrivateKey(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: pkcs8}))
+	if err != nil {
+		t.Fatalf("ParsePrivateKey() error = %v", err)
+	}
+	if again, _ := PublicKeyFingerprint(parsed); again != fingerprint {
+		t.Errorf("fingerprint of PKCS#8 encoding = %v, want %v", again, fingerprint)
+	}
+}
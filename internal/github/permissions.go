@@ -0,0 +1,55 @@
+package github
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+)
+
+// permissionLevels orders access levels so a granted level can be compared with a required one
+var permissionLevels = map[string]int{
+	"read":  1,
+	"write": 2,
+	"admin": 3,
+}
+
+var permissionNamePattern = regexp.MustCompile(`^[a-z][a-z_]*$`)
+
+// DefaultPermissions returns the read-only permissions requested for installation tokens when none are configured
+func DefaultPermissions() map[string]string {
+	return map[string]string{
+		"metadata": "read",
+		"contents": "read",
+	}
+}
+
+// ValidatePermissions checks that permission names look like GitHub's and that each level is read, write or admin
+func ValidatePermissions(permissions map[string]string) error {
+	names := make([]string, 0, len(permissions))
+	for name := range permissions {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	for _, name := range names {
+		if !permissionNamePattern.MatchString(name) {
+			return fmt.Errorf("invalid permission name %q - use GitHub's snake_case names such as metadata or contents", name)
+		}
+		if _, ok := permissionLevels[permissions[name]]; !ok {
+			return fmt.Errorf("invalid level %q for permission %s - must be read, write or admin", permissions[name], name)
+		}
+	}
+	return nil
+}
+
+// MissingPermissions returns the required permissions, as "name:level", that granted doesn't satisfy
+func MissingPermissions(required, granted map[string]string) []string {
+	var missing []string
+	for name, level := range required {
+		if permissionLevels[granted[name]] < permissionLevels[level] {
+			missing = append(missing, name+":"+level)
+		}
+	}
+	slices.Sort(missing)
+	return missing
+}
@@ -0,0 +1,168 @@
+package github
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestValidatePermissions(t *testing.T) {
+	tests := []struct {
+		name        string
+		permissions map[string]string
+		wantErr     string
+	}{
+		{name: "defaults", permissions: DefaultPermissions()},
+		{name: "newer permission names", permissions: map[string]string{"organization_custom_properties": "read"}},
+		{name: "write and admin", permissions: map[string]string{"issues": "write", "administration": "admin"}},
+		{name: "invalid level", permissions: map[string]string{"contents": "full"}, wantErr: `invalid level "full" for permission contents`},
+		{name: "invalid name", permissions: map[string]string{"Contents": "read"}, wantErr: `invalid permission name "Contents"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidatePermissions(tt.permissions)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("ValidatePermissions() unexpected error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("ValidatePermissions() error = %v, expected to contain %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestMissingPermissions(t *testing.T) {
+	granted := map[string]string{"metadata": "read", "contents": "write"}
+
+	tests := []struct {
+		name     string
+		required map[string]string
+		want     []string
+	}{
+		{name: "satisfied", required: map[string]string{"metadata": "read"}},
+		{name: "higher level granted", required: map[string]string{"contents": "read"}},
+		{name: "level too low", required: map[string]string{"metadata": "write"}, want: []string{"metadata:write"}},
+		{name: "not granted", required: map[string]string{"members": "read", "issues": "read"}, want: []string{"issues:read", "members:read"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := MissingPermissions(tt.required, granted); !slices.Equal(got, tt.want) {
+				t.Errorf("MissingPermissions() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestInstallationTokenPermissions(t *testing.T) {
+	keyPEM := encodeTestKey(generateTestKey(t))
+	ctx := context.Background()
+
+	var requests []installationTokenRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != fmt.Sprintf("/api/v3/app/installations/%d/access_tokens", testInstallationID) {
+			t.Errorf("unexpected request to %s", r.URL.Path)
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		var req installationTokenRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("failed to decode token request: %v", err)
+		}
+		requests = append(requests, req)
+
+		if req.Permissions["administration"] != "" {
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			if _, err := w.Write([]byte(`{"message": "The permissions requested are not granted to this installation."}`)); err != nil {
+				t.Errorf("Failed to write response: %v", err)
+			}
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		if err := json.NewEncoder(w).Encode(map[string]any{
+			"token":       "scoped-token",
+			"expires_at":  "2099-01-01T00:00:00Z",
+			"permissions": req.Permissions,
+		}); err != nil {
+			t.Errorf("Failed to encode response: %v", err)
+		}
+	}))
+	defer server.Close()
+
+	creds := Credentials{
+		AppID:          testAppID,
+		InstallationID: testInstallationID,
+		PrivateKeyPEM:  keyPEM,
+		Permissions:    DefaultPermissions(),
+	}
+	client, err := NewGitHubAppClient(ctx, creds, Options{BaseURL: server.URL})
+	if err != nil {
+		t.Fatalf("NewGitHubAppClient() error = %v", err)
+	}
+
+	if got := client.GrantedPermissions(); got["metadata"] != "read" || got["contents"] != "read" || len(got) != 2 {
+		t.Errorf("GrantedPermissions() = %v, want the defaults", got)
+	}
+	if len(requests[0].RepositoryIDs) != 0 {
+		t.Errorf("RepositoryIDs = %v, want none for the org-wide token", requests[0].RepositoryIDs)
+	}
+
+	t.Run("restricted to repositories", func(t *testing.T) {
+		restricted, err := client.RestrictToRepositories([]int64{1, 2})
+		if err != nil {
+			t.Fatalf("RestrictToRepositories() error = %v", err)
+		}
+		if restricted.GitHubClient == nil {
+			t.Error("GitHubClient should not be nil")
+		}
+
+		last := requests[len(requests)-1]
+		if !slices.Equal(last.RepositoryIDs, []int64{1, 2}) {
+			t.Errorf("RepositoryIDs = %v, want [1 2]", last.RepositoryIDs)
+		}
+		if last.Permissions["metadata"] != "read" {
+			t.Errorf("restricted token should keep the requested permissions, got %v", last.Permissions)
+		}
+	})
+
+	t.Run("too many repositories", func(t *testing.T) {
+		_, err := client.RestrictToRepositories(make([]int64, MaxTokenRepositories+1))
+		if err == nil || !strings.Contains(err.Error(), "at most 500 repositories") {
+			t.Errorf("RestrictToRepositories() error = %v, expected limit error", err)
+		}
+	})
+
+	t.Run("permissions not granted to installation", func(t *testing.T) {
+		creds := creds
+		creds.Permissions = map[string]string{"administration": "write"}
+		_, err := NewGitHubAppClient(ctx, creds, Options{BaseURL: server.URL})
+		if err == nil || !strings.Contains(err.Error(), "may exceed those granted to the App installation") {
+			t.Errorf("NewGitHubAppClient() error = %v, expected permissions error", err)
+		}
+	})
+
+	t.Run("token clients cannot be restricted", func(t *testing.T) {
+		tokenClient, err := NewTokenClient("test-token", Options{})
+		if err != nil {
+			t.Fatalf("NewTokenClient() error = %v", err)
+		}
+		if tokenClient.GrantedPermissions() != nil {
+			t.Error("GrantedPermissions() should be nil for token authentication")
+		}
+		if _, err := tokenClient.RestrictToRepositories([]int64{1}); err == nil {
+			t.Error("RestrictToRepositories() expected error for token authentication")
+		}
+	})
+}
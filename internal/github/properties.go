@@ -0,0 +1,91 @@
+package github
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// CustomProperty is one value of an organization custom property set on a repository.
+// Multi-select properties have a CustomProperty per selected value.
+type CustomProperty struct {
+	Org          string
+	FullName     string
+	Name         string
+	PropertyName string
+	Value        string
+}
+
+// RepositoryCustomProperties are the custom property values set on a repository, keyed by property name
+type RepositoryCustomProperties struct {
+	RepositoryID int64
+	FullName     string
+	Name         string
+	Properties   map[string][]string
+}
+
+// repoPropertyValues is GitHub's response for a repository's property values. Values are decoded by hand
+// because multi-select properties have a list of strings where other properties have a string.
+type repoPropertyValues struct {
+	RepositoryID       int64  `json:"repository_id"`
+	RepositoryName     string `json:"repository_name"`
+	RepositoryFullName string `json:"repository_full_name"`
+	Properties         []struct {
+		PropertyName string          `json:"property_name"`
+		Value        json.RawMessage `json:"value"`
+	} `json:"properties"`
+}
+
+// ListCustomPropertyValues returns the custom property values of every repository in the organization
+func (c *Client) ListCustomPropertyValues(ctx context.Context, org string) ([]RepositoryCustomProperties, error) {
+	var all []RepositoryCustomProperties
+	for page := 1; page != 0; {
+		req, err := c.GitHubClient.NewRequest(http.MethodGet, fmt.Sprintf("orgs/%s/properties/values?per_page=100&page=%d", org, page), nil)
+		if err != nil {
+			return nil, err
+		}
+		var values []repoPropertyValues
+		resp, err := c.GitHubClient.Do(ctx, req, &values)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, v := range values {
+			repo := RepositoryCustomProperties{
+				RepositoryID: v.RepositoryID,
+				FullName:     v.RepositoryFullName,
+				Name:         v.RepositoryName,
+				Properties:   make(map[string][]string, len(v.Properties)),
+			}
+			for _, p := range v.Properties {
+				propertyValues, err := decodePropertyValue(p.Value)
+				if err != nil {
+					return nil, fmt.Errorf("failed to decode property %s of %s: %w", p.PropertyName, v.RepositoryFullName, err)
+				}
+				if len(propertyValues) > 0 {
+					repo.Properties[p.PropertyName] = propertyValues
+				}
+			}
+			all = append(all, repo)
+		}
+		page = resp.NextPage
+	}
+	return all, nil
+}
+
+// decodePropertyValue decodes a property value that is null, a string or a list of strings
+func decodePropertyValue(raw json.RawMessage) ([]string, error) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil, nil
+	}
+	var value string
+	if err := json.Unmarshal(raw, &value); err == nil {
+		return []string{value}, nil
+	}
+	var values []string
+	if err := json.Unmarshal(raw, &values); err != nil {
+		return nil, fmt.Errorf("value must be a string or a list of strings: %w", err)
+	}
+	return values, nil
+}
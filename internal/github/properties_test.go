@@ -0,0 +1,61 @@
+package github
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+
+	"github.com/google/go-github/v57/github"
+)
+
+func TestListCustomPropertyValues(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/orgs/"+testOrg+"/properties/values" {
+			t.Errorf("Expected path /orgs/%s/properties/values, got %s", testOrg, r.URL.Path)
+		}
+		if r.URL.Query().Get("page") == "1" {
+			w.Header().Set("Link", `<`+"http://"+r.Host+r.URL.Path+`?page=2>; rel="next"`)
+			w.Write([]byte(`[{"repository_id": 1, "repository_name": "api", "repository_full_name": "test-org/api", "properties": [
+				{"property_name": "service-tier", "value": "production"},
+				{"property_name": "regions", "value": ["eu-west-1", "us-east-1"]},
+				{"property_name": "owning-team", "value": null}
+			]}]`))
+			return
+		}
+		w.Write([]byte(`[{"repository_id": 2, "repository_name": "docs", "repository_full_name": "test-org/docs", "properties": []}]`))
+	}))
+	defer server.Close()
+
+	githubClient := github.NewClient(&http.Client{})
+	githubClient.BaseURL, _ = url.Parse(server.URL + "/")
+	client := &Client{GitHubClient: githubClient}
+
+	got, err := client.ListCustomPropertyValues(context.Background(), testOrg)
+	if err != nil {
+		t.Fatalf("ListCustomPropertyValues() error = %v", err)
+	}
+	want := []RepositoryCustomProperties{
+		{
+			RepositoryID: 1,
+			FullName:     "test-org/api",
+			Name:         "api",
+			Properties:   map[string][]string{"service-tier": {"production"}, "regions": {"eu-west-1", "us-east-1"}},
+		},
+		{RepositoryID: 2, FullName: "test-org/docs", Name: "docs", Properties: map[string][]string{}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ListCustomPropertyValues() = %+v, want %+v", got, want)
+	}
+}
+
+func TestDecodePropertyValue(t *testing.T) {
+	if _, err := decodePropertyValue([]byte(`{"not": "a value"}`)); err == nil {
+		t.Error("decodePropertyValue() expected an error for an object")
+	}
+	if got, err := decodePropertyValue([]byte(`true`)); err == nil {
+		t.Errorf("decodePropertyValue() = %v, expected an error for a boolean", got)
+	}
+}
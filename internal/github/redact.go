@@ -0,0 +1,46 @@
+package github
+
+import "regexp"
+
+// redacted replaces secrets in anything that is logged
+const redacted = "[REDACTED]"
+
+// secretPatterns match credentials that must never reach the logs
+var secretPatterns = []*regexp.Regexp{
+	// PEM private keys in any encoding, including the key material between the markers
+	regexp.MustCompile(`-----BEGIN [A-Z0-9 ]*PRIVATE KEY-----[\s\S]*?(-----END [A-Z0-9 ]*PRIVATE KEY-----|$)`),
+	// JWTs, such as the App's signed assertions; the header always starts with {" so base64url encodes to eyJ
+	regexp.MustCompile(`eyJ[A-Za-z0-9_-]*\.[A-Za-z0-9_-]+\.[A-Za-z0-9_-]*`),
+	// GitHub installation (ghs_), personal (ghp_), OAuth (gho_), user (ghu_) and refresh (ghr_) tokens
+	regexp.MustCompile(`\bgh[pousr]_[A-Za-z0-9]{16,}`),
+	// Fine-grained personal access tokens
+	regexp.MustCompile(`\bgithub_pat_[A-Za-z0-9_]{16,}`),
+}
+
+// Redact replaces tokens, JWTs and private key material in s
+func Redact(s string) string {
+	for _, pattern := range secretPatterns {
+		s = pattern.ReplaceAllString(s, redacted)
+	}
+	return s
+}
+
+// RedactError wraps err so that its message is redacted when logged. errors.Is and errors.As still see the original.
+func RedactError(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &redactedError{err: err}
+}
+
+type redactedError struct {
+	err error
+}
+
+func (e *redactedError) Error() string {
+	return Redact(e.err.Error())
+}
+
+func (e *redactedError) Unwrap() error {
+	return e.err
+}
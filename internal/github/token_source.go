@@ -0,0 +1,264 @@
+package github
+
+import (
+	"bytes"
+	"context"
+	"crypto/rsa"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/google/go-github/v57/github"
+	"github.com/rs/zerolog"
+	"golang.org/x/oauth2"
+)
+
+const (
+	// jwtBackdate is subtracted from the issued-at time to allow for clock skew between us and GitHub
+	jwtBackdate = 60 * time.Second
+	// jwtLifetime is the maximum lifetime GitHub accepts for an App JWT
+	jwtLifetime = 10 * time.Minute
+	// tokenRefreshWindow is how long before expiry an installation token is replaced
+	tokenRefreshWindow = 5 * time.Minute
+	// installationTokenLifetime is GitHub's documented lifetime, used if a response has no expires_at
+	installationTokenLifetime = time.Hour
+	// tokenRequestTimeout bounds a single installation token request
+	tokenRequestTimeout = 30 * time.Second
+)
+
+// appJWTTransport is an http.RoundTripper that authenticates requests as the GitHub App itself,
+// signing a fresh JWT for every request so it never expires mid-sync.
+//
+// JWTs are signed against GitHub's clock rather than ours: the offset between the two is estimated from the
+// Date header of each response, and a request GitHub rejects because of the JWT's timing is retried once.
+type appJWTTransport struct {
+	appID      int64
+	privateKey *rsa.PrivateKey
+	now        func() time.Time
+	base       http.RoundTripper
+	logger     zerolog.Logger
+
+	mu     sync.Mutex
+	offset time.Duration
+}
+
+// clockOffset returns how far GitHub's clock is estimated to be ahead of ours
+func (t *appJWTTransport) clockOffset() time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.offset
+}
+
+// observeServerTime updates the clock offset from a response's Date header, returning false if there wasn't one
+func (t *appJWTTransport) observeServerTime(resp *http.Response) bool {
+	serverTime, err := http.ParseTime(resp.Header.Get("Date"))
+	if err != nil {
+		return false
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.offset = serverTime.Sub(t.now())
+	return true
+}
+
+func (t *appJWTTransport) signJWT() (string, error) {
+	now := t.now().Add(t.clockOffset())
+	claims := jwt.MapClaims{
+		"iat": jwt.NewNumericDate(now.Add(-jwtBackdate)),
+		"exp": jwt.NewNumericDate(now.Add(jwtLifetime)),
+		"iss": t.appID,
+	}
+
+	signed, err := jwt.NewWithClaims(jwt.SigningMethodRS256, claims).SignedString(t.privateKey)
+	if err != nil {
+		return "", fmt.Errorf("failed to sign JWT token: %w", err)
+	}
+
+	t.logger.Trace().
+		Int64("app_id", t.appID).
+		Time("issued_at", now.Add(-jwtBackdate)).
+		Time("expires_at", now.Add(jwtLifetime)).
+		Msg("signed app JWT")
+	return signed, nil
+}
+
+func (t *appJWTTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.send(req)
+	if err != nil {
+		return nil, err
+	}
+	if !t.observeServerTime(resp) || resp.StatusCode != http.StatusUnauthorized {
+		return resp, nil
+	}
+
+	// Only the body of an authentication failure is inspected, and it is put back for the caller
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxErrorBodySize))
+	resp.Body.Close()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read GitHub response: %w", err)
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+
+	if !isJWTTimingError(body) || (req.Body != nil && req.GetBody == nil) {
+		return resp, nil
+	}
+
+	t.logger.Warn().
+		Dur("clock_offset", t.clockOffset()).
+		Msg("GitHub rejected the app JWT's issued or expiry time - retrying using GitHub's clock")
+
+	retry := req.Clone(req.Context())
+	if req.GetBody != nil {
+		if retry.Body, err = req.GetBody(); err != nil {
+			return nil, fmt.Errorf("failed to rewind request body: %w", err)
+		}
+	}
+	resp.Body.Close()
+	return t.send(retry)
+}
+
+// send signs a JWT for the request and sends it on the base transport
+func (t *appJWTTransport) send(req *http.Request) (*http.Response, error) {
+	signed, err := t.signJWT()
+	if err != nil {
+		return nil, err
+	}
+
+	// RoundTrippers must not modify the caller's request
+	r := req.Clone(req.Context())
+	r.Header.Set("Authorization", "Bearer "+signed)
+
+	base := t.base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return base.RoundTrip(r)
+}
+
+// maxErrorBodySize bounds how much of an error response is read to check for a JWT timing error
+const maxErrorBodySize = 64 << 10
+
+// isJWTTimingError reports whether GitHub rejected a JWT because of its iat or exp claim, which happens
+// when our clock is ahead of or behind GitHub's by more than the backdate allows
+func isJWTTimingError(body []byte) bool {
+	return bytes.Contains(body, []byte("('iat')")) || bytes.Contains(body, []byte("('exp')"))
+}
+
+// MaxTokenRepositories is the most repositories GitHub allows an installation token to be restricted to
+const MaxTokenRepositories = 500
+
+// installationTokenRequest is the body of a create-installation-token request. It is used instead of
+// go-github's InstallationTokenOptions so permissions newer than the library can still be requested.
+type installationTokenRequest struct {
+	Permissions   map[string]string `json:"permissions,omitempty"`
+	RepositoryIDs []int64           `json:"repository_ids,omitempty"`
+}
+
+// installationTokenResponse decodes permissions as a map for the same reason
+type installationTokenResponse struct {
+	Token       *string           `json:"token,omitempty"`
+	ExpiresAt   *github.Timestamp `json:"expires_at,omitempty"`
+	Permissions map[string]string `json:"permissions,omitempty"`
+}
+
+// installationTokenSource is an oauth2.TokenSource that mints GitHub App installation tokens
+// and replaces them shortly before they expire. It is safe for concurrent use.
+type installationTokenSource struct {
+	mu             sync.Mutex
+	appClient      *github.Client
+	installationID int64
+	request        installationTokenRequest
+	now            func() time.Time
+	token          *oauth2.Token
+	granted        map[string]string
+	logger         zerolog.Logger
+}
+
+func newInstallationTokenSource(appClient *github.Client, installationID int64, request installationTokenRequest, now func() time.Time, logger zerolog.Logger) *installationTokenSource {
+	return &installationTokenSource{
+		appClient:      appClient,
+		installationID: installationID,
+		request:        request,
+		now:            now,
+		logger:         logger.With().Int64("installation_id", installationID).Logger(),
+	}
+}
+
+// withRepositories returns a new token source for the same installation and permissions,
+// whose tokens can only access the given repositories
+func (s *installationTokenSource) withRepositories(repositoryIDs []int64) *installationTokenSource {
+	request := installationTokenRequest{
+		Permissions:   s.request.Permissions,
+		RepositoryIDs: repositoryIDs,
+	}
+	return newInstallationTokenSource(s.appClient, s.installationID, request, s.now, s.logger)
+}
+
+// grantedPermissions returns the permissions GitHub granted the most recent token
+func (s *installationTokenSource) grantedPermissions() map[string]string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return maps.Clone(s.granted)
+}
+
+// Token returns the cached installation token, minting a new one if it is missing or about to expire.
+func (s *installationTokenSource) Token() (*oauth2.Token, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.token != nil && s.now().Before(s.token.Expiry.Add(-tokenRefreshWindow)) {
+		return s.token, nil
+	}
+
+	s.logger.Debug().
+		Bool("refresh", s.token != nil).
+		Interface("permissions", s.request.Permissions).
+		Int("repository_count", len(s.request.RepositoryIDs)).
+		Msg("requesting installation token")
+
+	ctx, cancel := context.WithTimeout(context.Background(), tokenRequestTimeout)
+	defer cancel()
+
+	req, err := s.appClient.NewRequest(http.MethodPost, fmt.Sprintf("app/installations/%v/access_tokens", s.installationID), &s.request)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build installation token request: %w", err)
+	}
+
+	installToken := new(installationTokenResponse)
+	resp, err := s.appClient.Do(ctx, req, installToken)
+	if err != nil {
+		if resp != nil && resp.StatusCode == http.StatusUnprocessableEntity && len(s.request.Permissions) > 0 {
+			return nil, fmt.Errorf("failed to create installation token (HTTP %d): %w - the requested permissions %v may exceed those granted to the App installation", resp.StatusCode, err, s.request.Permissions)
+		}
+		if resp != nil {
+			return nil, fmt.Errorf("failed to create installation token (HTTP %d): %w", resp.StatusCode, err)
+		}
+		return nil, fmt.Errorf("failed to create installation token: %w", err)
+	}
+	if installToken.Token == nil {
+		return nil, fmt.Errorf("received nil installation token")
+	}
+
+	expiry := s.now().Add(installationTokenLifetime)
+	if installToken.ExpiresAt != nil {
+		expiry = installToken.ExpiresAt.Time
+	}
+
+	s.granted = installToken.Permissions
+	s.token = &oauth2.Token{
+		AccessToken: *installToken.Token,
+		TokenType:   "token",
+		Expiry:      expiry,
+	}
+
+	s.logger.Info().
+		Time("expires_at", expiry).
+		Interface("granted_permissions", installToken.Permissions).
+		Msg("created installation token")
+	return s.token, nil
+}
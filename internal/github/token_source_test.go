@@ -0,0 +1,346 @@
+package github
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/google/go-github/v57/github"
+	"github.com/rs/zerolog"
+)
+
+// fakeClock is a manually advanced clock for exercising token expiry
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+func generateTestKey(t *testing.T) *rsa.PrivateKey {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("failed to generate RSA key: %v", err)
+	}
+	return key
+}
+
+// newTokenServer returns a GitHub stand-in that issues installation tokens valid for an hour
+// of the fake clock, verifying that each request carries a JWT signed by key
+func newTokenServer(t *testing.T, clock *fakeClock, key *rsa.PrivateKey, calls *int32) *httptest.Server {
+	t.Helper()
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		expectedPath := fmt.Sprintf("/app/installations/%d/access_tokens", testInstallationID)
+		if r.Method != http.MethodPost || r.URL.Path != expectedPath {
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		bearer := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		parser := jwt.NewParser(jwt.WithoutClaimsValidation())
+		if _, err := parser.Parse(bearer, func(*jwt.Token) (interface{}, error) { return &key.PublicKey, nil }); err != nil {
+			t.Errorf("request carried an invalid JWT: %v", err)
+		}
+
+		n := atomic.AddInt32(calls, 1)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		if err := json.NewEncoder(w).Encode(map[string]any{
+			"token":      fmt.Sprintf("token-%d", n),
+			"expires_at": clock.Now().Add(time.Hour).Format(time.RFC3339),
+		}); err != nil {
+			t.Errorf("Failed to encode response: %v", err)
+		}
+	}))
+}
+
+func newTestTokenSource(t *testing.T, server *httptest.Server, clock *fakeClock, key *rsa.PrivateKey) *installationTokenSource {
+	t.Helper()
+	appClient := github.NewClient(&http.Client{Transport: &appJWTTransport{
+		appID:      testAppID,
+		privateKey: key,
+		now:        clock.Now,
+	}})
+	appClient.BaseURL, _ = url.Parse(server.URL + "/")
+	return newInstallationTokenSource(appClient, testInstallationID, installationTokenRequest{}, clock.Now, zerolog.Nop())
+}
+
+func TestInstallationTokenSource_ReusesTokenUntilRefreshWindow(t *testing.T) {
+	clock := newFakeClock()
+	key := generateTestKey(t)
+	var calls int32
+	server := newTokenServer(t, clock, key, &calls)
+	defer server.Close()
+
+	ts := newTestTokenSource(t, server, clock, key)
+
+	first, err := ts.Token()
+	if err != nil {
+		t.Fatalf("Token() error = %v", err)
+	}
+	if first.AccessToken != "token-1" {
+		t.Errorf("AccessToken = %v, want token-1", first.AccessToken)
+	}
+
+	// Still well inside the token's lifetime
+	clock.Advance(50 * time.Minute)
+	second, err := ts.Token()
+	if err != nil {
+		t.Fatalf("Token() error = %v", err)
+	}
+	if second.AccessToken != "token-1" {
+		t.Errorf("AccessToken = %v, want cached token-1", second.AccessToken)
+	}
+
+	// Inside the refresh window before expiry
+	clock.Advance(6 * time.Minute)
+	third, err := ts.Token()
+	if err != nil {
+		t.Fatalf("Token() error = %v", err)
+	}
+	if third.AccessToken != "token-2" {
+		t.Errorf("AccessToken = %v, want refreshed token-2", third.AccessToken)
+	}
+
+	if got := atomic.LoadInt32(&calls); got != 2 {
+		t.Errorf("token requests = %d, want 2", got)
+	}
+}
+
+func TestInstallationTokenSource_RefreshesAfterExpiry(t *testing.T) {
+	clock := newFakeClock()
+	key := generateTestKey(t)
+	var calls int32
+	server := newTokenServer(t, clock, key, &calls)
+	defer server.Close()
+
+	ts := newTestTokenSource(t, server, clock, key)
+
+	if _, err := ts.Token(); err != nil {
+		t.Fatalf("Token() error = %v", err)
+	}
+
+	// A sync running for several hours needs a fresh token each hour
+	for i := 2; i <= 4; i++ {
+		clock.Advance(2 * time.Hour)
+		tok, err := ts.Token()
+		if err != nil {
+			t.Fatalf("Token() error = %v", err)
+		}
+		if want := fmt.Sprintf("token-%d", i); tok.AccessToken != want {
+			t.Errorf("AccessToken = %v, want %v", tok.AccessToken, want)
+		}
+	}
+}
+
+func TestInstallationTokenSource_Concurrent(t *testing.T) {
+	clock := newFakeClock()
+	key := generateTestKey(t)
+	var calls int32
+	server := newTokenServer(t, clock, key, &calls)
+	defer server.Close()
+
+	ts := newTestTokenSource(t, server, clock, key)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := ts.Token(); err != nil {
+				t.Errorf("Token() error = %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if got := atomic.LoadInt32(&calls); got != 1 {
+		t.Errorf("token requests = %d, want 1 for concurrent callers", got)
+	}
+}
+
+func TestInstallationTokenSource_Error(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+		if _, err := w.Write([]byte(`{"message": "Bad credentials"}`)); err != nil {
+			t.Errorf("Failed to write response: %v", err)
+		}
+	}))
+	defer server.Close()
+
+	ts := newTestTokenSource(t, server, newFakeClock(), generateTestKey(t))
+
+	_, err := ts.Token()
+	if err == nil {
+		t.Fatal("Token() expected error but got none")
+	}
+	if !strings.Contains(err.Error(), "HTTP 401") {
+		t.Errorf("error = %v, expected to contain HTTP 401", err)
+	}
+}
+
+func TestAppJWTTransport_SignsWithFakeClock(t *testing.T) {
+	clock := newFakeClock()
+	key := generateTestKey(t)
+	tr := &appJWTTransport{appID: testAppID, privateKey: key, now: clock.Now}
+
+	signed, err := tr.signJWT()
+	if err != nil {
+		t.Fatalf("signJWT() error = %v", err)
+	}
+
+	claims := jwt.MapClaims{}
+	parser := jwt.NewParser(jwt.WithoutClaimsValidation())
+	if _, err := parser.ParseWithClaims(signed, claims, func(*jwt.Token) (interface{}, error) { return &key.PublicKey, nil }); err != nil {
+		t.Fatalf("failed to parse JWT: %v", err)
+	}
+
+	if iss, _ := claims["iss"].(float64); int64(iss) != testAppID {
+		t.Errorf("iss = %v, want %v", claims["iss"], testAppID)
+	}
+	if iat, _ := claims["iat"].(float64); int64(iat) != clock.Now().Add(-jwtBackdate).Unix() {
+		t.Errorf("iat = %v, want %v", claims["iat"], clock.Now().Add(-jwtBackdate).Unix())
+	}
+	if exp, _ := claims["exp"].(float64); int64(exp) != clock.Now().Add(jwtLifetime).Unix() {
+		t.Errorf("exp = %v, want %v", claims["exp"], clock.Now().Add(jwtLifetime).Unix())
+	}
+}
+
+// newSkewedTokenServer returns a GitHub stand-in whose clock is serverNow. Like GitHub, it rejects JWTs
+// issued in its future or already expired, and reports its time in the Date header unless omitDate is set.
+func newSkewedTokenServer(t *testing.T, serverNow func() time.Time, key *rsa.PrivateKey, calls *int32, omitDate bool) *httptest.Server {
+	t.Helper()
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(calls, 1)
+		now := serverNow()
+		if omitDate {
+			// A nil value stops net/http adding the Date header itself
+			w.Header()["Date"] = nil
+		} else {
+			w.Header().Set("Date", now.UTC().Format(http.TimeFormat))
+		}
+		w.Header().Set("Content-Type", "application/json")
+
+		var req installationTokenRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("request body was not replayed: %v", err)
+		}
+
+		claims := jwt.MapClaims{}
+		bearer := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		parser := jwt.NewParser(jwt.WithoutClaimsValidation())
+		if _, err := parser.ParseWithClaims(bearer, claims, func(*jwt.Token) (interface{}, error) { return &key.PublicKey, nil }); err != nil {
+			t.Errorf("request carried an invalid JWT: %v", err)
+		}
+		iat, _ := claims["iat"].(float64)
+		exp, _ := claims["exp"].(float64)
+
+		switch {
+		case int64(iat) > now.Unix():
+			w.WriteHeader(http.StatusUnauthorized)
+			fmt.Fprint(w, `{"message": "'Issued at' claim ('iat') must be an Integer representing a time in the past."}`)
+		case int64(exp) <= now.Unix():
+			w.WriteHeader(http.StatusUnauthorized)
+			fmt.Fprint(w, `{"message": "'Expiration time' claim ('exp') must be a numeric value representing the future time at which the assertion expires."}`)
+		default:
+			w.WriteHeader(http.StatusCreated)
+			fmt.Fprintf(w, `{"token": "token-%d", "expires_at": %q}`, atomic.LoadInt32(calls), now.Add(time.Hour).Format(time.RFC3339))
+		}
+	}))
+}
+
+func TestAppJWTTransport_ClockSkew(t *testing.T) {
+	tests := []struct {
+		name      string
+		skew      time.Duration
+		omitDate  bool
+		wantCalls int32
+		wantErr   bool
+	}{
+		{name: "clocks agree", skew: 0, wantCalls: 1},
+		{name: "local clock ahead", skew: -5 * time.Minute, wantCalls: 2},
+		{name: "local clock behind", skew: 15 * time.Minute, wantCalls: 2},
+		{name: "no Date header to correct from", skew: -5 * time.Minute, omitDate: true, wantCalls: 1, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clock := newFakeClock()
+			key := generateTestKey(t)
+			var calls int32
+			server := newSkewedTokenServer(t, func() time.Time { return clock.Now().Add(tt.skew) }, key, &calls, tt.omitDate)
+			defer server.Close()
+
+			ts := newTestTokenSource(t, server, clock, key)
+			_, err := ts.Token()
+			if tt.wantErr {
+				if err == nil || !strings.Contains(err.Error(), "HTTP 401") {
+					t.Errorf("Token() error = %v, expected HTTP 401", err)
+				}
+			} else if err != nil {
+				t.Fatalf("Token() error = %v", err)
+			}
+			if got := atomic.LoadInt32(&calls); got != tt.wantCalls {
+				t.Errorf("requests = %d, want %d", got, tt.wantCalls)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			// The estimated offset is kept, so the next exchange succeeds first time
+			clock.Advance(2 * time.Hour)
+			if _, err := ts.Token(); err != nil {
+				t.Fatalf("Token() after refresh error = %v", err)
+			}
+			if got := atomic.LoadInt32(&calls); got != tt.wantCalls+1 {
+				t.Errorf("requests after refresh = %d, want %d", got, tt.wantCalls+1)
+			}
+		})
+	}
+}
+
+func TestAppJWTTransport_RetriesOnlyOnce(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.Header().Set("Date", time.Now().UTC().Format(http.TimeFormat))
+		w.WriteHeader(http.StatusUnauthorized)
+		fmt.Fprint(w, `{"message": "'Issued at' claim ('iat') must be an Integer representing a time in the past."}`)
+	}))
+	defer server.Close()
+
+	ts := newTestTokenSource(t, server, newFakeClock(), generateTestKey(t))
+	_, err := ts.Token()
+	if err == nil || !strings.Contains(err.Error(), "'Issued at' claim") {
+		t.Errorf("Token() error = %v, expected GitHub's message to be reported", err)
+	}
+	if got := atomic.LoadInt32(&calls); got != 2 {
+		t.Errorf("requests = %d, want 2", got)
+	}
+}
@@ -0,0 +1,174 @@
+package github
+
+import (
+	"context"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTLSGitHubServer returns a TLS GitHub stand-in that issues installation tokens and lists the test org's repositories
+func newTLSGitHubServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	return httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case fmt.Sprintf("/api/v3/app/installations/%d/access_tokens", testInstallationID):
+			w.WriteHeader(http.StatusCreated)
+			fmt.Fprint(w, `{"token": "test-token", "expires_at": "2099-01-01T00:00:00Z"}`)
+		case "/api/v3/orgs/" + testOrg + "/repos":
+			fmt.Fprint(w, `[{"name": "repo"}]`)
+		default:
+			t.Errorf("unexpected request to %s", r.URL.Path)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+}
+
+// writeCABundle writes the TLS server's certificate to a PEM file for use as ca_bundle_path
+func writeCABundle(t *testing.T, server *httptest.Server) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "ca.pem")
+	bundle := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	if err := os.WriteFile(path, bundle, 0600); err != nil {
+		t.Fatalf("failed to write CA bundle: %v", err)
+	}
+	return path
+}
+
+func TestTLSOptions(t *testing.T) {
+	ctx := context.Background()
+	server := newTLSGitHubServer(t)
+	defer server.Close()
+
+	keyPEM := encodeTestKey(generateTestKey(t))
+	caBundle := writeCABundle(t, server)
+
+	tests := []struct {
+		name    string
+		opts    Options
+		wantErr string
+	}{
+		{name: "untrusted certificate", opts: Options{BaseURL: server.URL}, wantErr: "certificate"},
+		{name: "custom CA bundle", opts: Options{BaseURL: server.URL, CABundlePath: caBundle}},
+		{name: "insecure skip verify", opts: Options{BaseURL: server.URL, InsecureSkipVerify: true}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// The JWT client is used to mint the installation token, then the installation client lists repositories
+			client, err := NewGitHubAppClient(ctx, Credentials{
+				AppID:          testAppID,
+				InstallationID: testInstallationID,
+				PrivateKeyPEM:  keyPEM,
+			}, tt.opts)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("NewGitHubAppClient() error = %v, expected to contain %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("NewGitHubAppClient() error = %v", err)
+			}
+			if _, _, err := client.GitHubClient.Repositories.ListByOrg(ctx, testOrg, nil); err != nil {
+				t.Errorf("ListByOrg() error = %v", err)
+			}
+
+			tokenClient, err := NewTokenClient("test-token", tt.opts)
+			if err != nil {
+				t.Fatalf("NewTokenClient() error = %v", err)
+			}
+			if _, _, err := tokenClient.GitHubClient.Repositories.ListByOrg(ctx, testOrg, nil); err != nil {
+				t.Errorf("ListByOrg() with token client error = %v", err)
+			}
+		})
+	}
+}
+
+func TestProxyURL(t *testing.T) {
+	ctx := context.Background()
+
+	// A plain HTTP proxy receives requests with the absolute URL of the target
+	var proxied []string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied = append(proxied, r.URL.String())
+		w.Header().Set("Content-Type", "application/json")
+		if strings.HasSuffix(r.URL.Path, "/access_tokens") {
+			w.WriteHeader(http.StatusCreated)
+			fmt.Fprint(w, `{"token": "test-token", "expires_at": "2099-01-01T00:00:00Z"}`)
+			return
+		}
+		fmt.Fprint(w, `[]`)
+	}))
+	defer proxy.Close()
+
+	opts := Options{BaseURL: "http://github.example.com", ProxyURL: proxy.URL}
+	client, err := NewGitHubAppClient(ctx, Credentials{
+		AppID:          testAppID,
+		InstallationID: testInstallationID,
+		PrivateKeyPEM:  encodeTestKey(generateTestKey(t)),
+	}, opts)
+	if err != nil {
+		t.Fatalf("NewGitHubAppClient() error = %v", err)
+	}
+	if _, _, err := client.GitHubClient.Repositories.ListByOrg(ctx, testOrg, nil); err != nil {
+		t.Fatalf("ListByOrg() error = %v", err)
+	}
+
+	want := []string{
+		fmt.Sprintf("http://github.example.com/api/v3/app/installations/%d/access_tokens", testInstallationID),
+		"http://github.example.com/api/v3/orgs/" + testOrg + "/repos",
+	}
+	if len(proxied) != len(want) {
+		t.Fatalf("proxied requests = %v, want %v", proxied, want)
+	}
+	for i := range want {
+		if proxied[i] != want[i] {
+			t.Errorf("proxied request %d = %v, want %v", i, proxied[i], want[i])
+		}
+	}
+}
+
+func TestRequestTimeout(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(5 * time.Second):
+		}
+	}))
+	defer server.Close()
+
+	client, err := NewTokenClient("test-token", Options{BaseURL: server.URL, RequestTimeout: 50 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("NewTokenClient() error = %v", err)
+	}
+
+	start := time.Now()
+	_, _, err = client.GitHubClient.Repositories.ListByOrg(context.Background(), testOrg, nil)
+	if err == nil {
+		t.Fatal("ListByOrg() expected timeout error but got none")
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("request took %v, expected it to time out", elapsed)
+	}
+}
+
+func TestLoadCABundle(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "empty.pem")
+	if err := os.WriteFile(path, []byte("not a certificate"), 0600); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+	if _, err := LoadCABundle(path); err == nil || !strings.Contains(err.Error(), "contains no PEM certificates") {
+		t.Errorf("LoadCABundle() error = %v, expected no certificates error", err)
+	}
+	if _, err := LoadCABundle("/nonexistent/ca.pem"); err == nil || !strings.Contains(err.Error(), "failed to read CA bundle") {
+		t.Errorf("LoadCABundle() error = %v, expected read error", err)
+	}
+}
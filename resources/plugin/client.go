@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"slices"
 
 	"github.com/cloudquery/plugin-sdk/v4/message"
 	"github.com/cloudquery/plugin-sdk/v4/plugin"
@@ -11,6 +12,7 @@ import (
 	"github.com/cloudquery/plugin-sdk/v4/schema"
 	"github.com/cloudquery/plugin-sdk/v4/transformers"
 	"github.com/guardian/cq-source-github-languages/client"
+	"github.com/guardian/cq-source-github-languages/internal/github"
 	"github.com/guardian/cq-source-github-languages/resources/services"
 	"github.com/rs/zerolog"
 )
@@ -38,9 +40,14 @@ func Configure(ctx context.Context, logger zerolog.Logger, spec []byte, opts plu
 		return nil, fmt.Errorf("failed to unmarshal spec: %w", err)
 	}
 
+	// Errors are returned to the CLI rather than logged here, so they are redacted before they leave
 	syncClient, err := client.New(ctx, logger, config)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create client: %w", err)
+		return nil, github.RedactError(fmt.Errorf("failed to create client: %w", err))
+	}
+	// Authenticate once up front so every table resolver shares the same GitHub clients
+	if err := syncClient.Connect(ctx); err != nil {
+		return nil, github.RedactError(fmt.Errorf("failed to connect to GitHub: %w", err))
 	}
 	return &Client{
 		logger:     logger,
@@ -61,6 +68,22 @@ func (c *Client) Sync(ctx context.Context, options plugin.SyncOptions, res chan<
 		return err
 	}
 
+	// Fail before syncing anything if the installation tokens can't read a table selected by name, and skip
+	// unreadable tables that were only matched by a wildcard
+	unreadable, err := services.UnreadableTables(c.syncClient, tt.FlattenTables(), options.Tables)
+	if err != nil {
+		return err
+	}
+	if len(unreadable) > 0 {
+		c.logger.Warn().Strs("tables", unreadable).Msg("skipping tables the installation tokens don't have permission to read")
+		tt, err = c.tables.FilterDfs(options.Tables, append(slices.Clone(options.SkipTables), unreadable...), options.SkipDependentTables)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Repository selections are shared by the tables within a sync, but not between syncs
+	c.syncClient.ResetMemo()
 	return c.scheduler.Sync(ctx, c.syncClient, tt, res, scheduler.WithSyncDeterministicCQID(options.DeterministicCQID))
 }
 
@@ -81,6 +104,8 @@ func (*Client) Close(_ context.Context) error {
 func getTables() schema.Tables {
 	tables := schema.Tables{
 		services.LanguagesTable(),
+		services.CustomPropertiesTable(),
+		services.ExcludedRepositoriesTable(),
 	}
 	if err := transformers.TransformTables(tables); err != nil {
 		panic(err)
@@ -12,5 +12,5 @@ var (
 )
 
 func Plugin() *plugin.Plugin {
-	return plugin.NewPlugin(Name, Version, Configure, plugin.WithKind(Kind), plugin.WithTeam(Team))
+	return plugin.NewPlugin(Name, Version, Configure, plugin.WithKind(Kind), plugin.WithTeam(Team), plugin.WithConnectionTester(TestConnection))
 }
@@ -0,0 +1,31 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/cloudquery/plugin-sdk/v4/plugin"
+	"github.com/guardian/cq-source-github-languages/client"
+	"github.com/guardian/cq-source-github-languages/internal/github"
+	"github.com/rs/zerolog"
+)
+
+// TestConnection backs `cloudquery test-connection`. It checks the private key, the App's JWT, the
+// installation and repository access, returning a distinct error code for whichever check fails.
+func TestConnection(ctx context.Context, logger zerolog.Logger, spec []byte) error {
+	config := &client.Spec{}
+	if err := json.Unmarshal(spec, config); err != nil {
+		return plugin.NewTestConnError(client.CodeInvalidSpec, fmt.Errorf("failed to unmarshal spec: %w", err))
+	}
+
+	// Errors are returned to the CLI rather than logged here, so they are redacted before they leave
+	testClient, err := client.New(ctx, logger, config)
+	if err != nil {
+		return plugin.NewTestConnError(client.ErrorCode(err), github.RedactError(err))
+	}
+	if err := testClient.TestConnection(ctx); err != nil {
+		return plugin.NewTestConnError(client.ErrorCode(err), github.RedactError(err))
+	}
+	return nil
+}
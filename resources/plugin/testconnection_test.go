@@ -0,0 +1,159 @@
+package plugin
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/cloudquery/plugin-sdk/v4/plugin"
+	"github.com/guardian/cq-source-github-languages/client"
+	"github.com/rs/zerolog"
+)
+
+const (
+	testAppID          = 12345
+	testInstallationID = 67890
+	testOrg            = "test-org"
+)
+
+// fakeGitHub is a GitHub stand-in whose responses to each connection check can be broken
+type fakeGitHub struct {
+	rejectJWT        bool
+	installationOrg  string
+	denyRepositories bool
+}
+
+func (f *fakeGitHub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	switch r.URL.Path {
+	case "/api/v3/app":
+		if f.rejectJWT {
+			w.WriteHeader(http.StatusUnauthorized)
+			fmt.Fprint(w, `{"message": "A JSON web token could not be decoded"}`)
+			return
+		}
+		fmt.Fprintf(w, `{"id": %d, "slug": "test-app"}`, testAppID)
+	case fmt.Sprintf("/api/v3/app/installations/%d", testInstallationID):
+		fmt.Fprintf(w, `{"id": %d, "account": {"login": %q, "type": "Organization"}}`, testInstallationID, f.installationOrg)
+	case fmt.Sprintf("/api/v3/app/installations/%d/access_tokens", testInstallationID):
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprint(w, `{"token": "test-token", "expires_at": "2099-01-01T00:00:00Z", "permissions": {"metadata": "read", "contents": "read"}}`)
+	case "/api/v3/orgs/" + testOrg + "/repos":
+		if f.denyRepositories {
+			w.WriteHeader(http.StatusForbidden)
+			fmt.Fprint(w, `{"message": "Resource not accessible by integration"}`)
+			return
+		}
+		fmt.Fprint(w, `[]`)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(w, `{"message": "Not Found"}`)
+	}
+}
+
+func generateKeyPEM(t *testing.T) string {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("failed to generate RSA key: %v", err)
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}))
+}
+
+func TestTestConnection(t *testing.T) {
+	logger := zerolog.New(zerolog.NewTestWriter(t))
+	keyPEM := generateKeyPEM(t)
+
+	tests := []struct {
+		name     string
+		github   fakeGitHub
+		spec     func(baseURL string) any
+		wantCode string
+	}{
+		{
+			name:   "all checks pass",
+			github: fakeGitHub{installationOrg: testOrg},
+		},
+		{
+			name:     "invalid spec",
+			spec:     func(string) any { return map[string]any{"org": testOrg} },
+			wantCode: client.CodeInvalidSpec,
+		},
+		{
+			name: "invalid private key",
+			spec: func(baseURL string) any {
+				return client.Spec{Org: testOrg, AppID: "12345", PrivateKey: "-----BEGIN CERTIFICATE-----\nMIIB\n-----END CERTIFICATE-----", BaseURL: baseURL}
+			},
+			wantCode: client.CodeInvalidPrivateKey,
+		},
+		{
+			name:     "JWT rejected",
+			github:   fakeGitHub{rejectJWT: true, installationOrg: testOrg},
+			wantCode: client.CodeInvalidAppCredentials,
+		},
+		{
+			name:     "installation belongs to another org",
+			github:   fakeGitHub{installationOrg: "other-org"},
+			wantCode: client.CodeInstallationNotFound,
+		},
+		{
+			name:   "installation not found",
+			github: fakeGitHub{installationOrg: testOrg},
+			spec: func(baseURL string) any {
+				return client.Spec{Org: testOrg, AppID: "12345", InstallationID: "1", PrivateKey: keyPEM, BaseURL: baseURL}
+			},
+			wantCode: client.CodeInstallationNotFound,
+		},
+		{
+			name:     "repositories not accessible",
+			github:   fakeGitHub{installationOrg: testOrg, denyRepositories: true},
+			wantCode: client.CodeRepositoryAccessDenied,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(&tt.github)
+			defer server.Close()
+
+			var spec any = client.Spec{
+				Org:            testOrg,
+				AppID:          fmt.Sprint(testAppID),
+				InstallationID: fmt.Sprint(testInstallationID),
+				PrivateKey:     keyPEM,
+				BaseURL:        server.URL,
+			}
+			if tt.spec != nil {
+				spec = tt.spec(server.URL)
+			}
+			specJSON, err := json.Marshal(spec)
+			if err != nil {
+				t.Fatalf("failed to marshal spec: %v", err)
+			}
+
+			err = TestConnection(context.Background(), logger, specJSON)
+			if tt.wantCode == "" {
+				if err != nil {
+					t.Errorf("TestConnection() unexpected error = %v", err)
+				}
+				return
+			}
+
+			var connErr *plugin.TestConnError
+			if !errors.As(err, &connErr) {
+				t.Fatalf("TestConnection() error = %v, want a *plugin.TestConnError", err)
+			}
+			if connErr.Code != tt.wantCode {
+				t.Errorf("TestConnection() code = %v, want %v (error: %v)", connErr.Code, tt.wantCode, err)
+			}
+		})
+	}
+}
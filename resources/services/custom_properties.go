@@ -0,0 +1,58 @@
+package services
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/cloudquery/plugin-sdk/v4/schema"
+	"github.com/cloudquery/plugin-sdk/v4/transformers"
+	"github.com/guardian/cq-source-github-languages/client"
+	"github.com/guardian/cq-source-github-languages/internal/github"
+)
+
+// CustomPropertiesTable has a row per custom property value set on each of an organization's repositories,
+// so they can be joined with github_languages on full_name
+func CustomPropertiesTable() *schema.Table {
+	return &schema.Table{
+		Name:      "github_languages_custom_properties",
+		Resolver:  fetchCustomProperties,
+		Multiplex: orgMultiplex,
+		Transform: transformers.TransformWithStruct(&github.CustomProperty{}),
+	}
+}
+
+func fetchCustomProperties(ctx context.Context, meta schema.ClientMeta, parent *schema.Resource, res chan<- any) error {
+	c, ok := meta.(*client.Client)
+	if !ok {
+		return fmt.Errorf("failed to assert meta as *client.Client")
+	}
+
+	gitHubClient := c.GitHub()
+	if gitHubClient == nil {
+		return fmt.Errorf("GitHub client is not initialized for org %s", c.Org())
+	}
+
+	values, err := gitHubClient.ListCustomPropertyValues(ctx, c.Org())
+	if err != nil {
+		return github.RedactError(fmt.Errorf("failed to list custom property values for org %s: %w", c.Org(), err))
+	}
+
+	count := 0
+	for _, repo := range values {
+		for name, propertyValues := range repo.Properties {
+			for _, value := range propertyValues {
+				res <- &github.CustomProperty{
+					Org:          c.Org(),
+					FullName:     repo.FullName,
+					Name:         repo.Name,
+					PropertyName: name,
+					Value:        value,
+				}
+				count++
+			}
+		}
+	}
+
+	c.Logger().Info().Int("repo_count", len(values)).Int("value_count", count).Msg("fetched custom property values")
+	return nil
+}
@@ -0,0 +1,61 @@
+package services
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/cloudquery/plugin-sdk/v4/schema"
+	"github.com/cloudquery/plugin-sdk/v4/transformers"
+	"github.com/guardian/cq-source-github-languages/client"
+	"github.com/guardian/cq-source-github-languages/internal/github"
+)
+
+// ExcludedRepositoriesTable has a row per repository that was listed but not synced to github_languages,
+// recording which spec option ruled it out
+func ExcludedRepositoriesTable() *schema.Table {
+	return &schema.Table{
+		Name:      "github_languages_excluded_repositories",
+		Resolver:  fetchExcludedRepositories,
+		Multiplex: orgMultiplex,
+		Transform: transformers.TransformWithStruct(&github.ExcludedRepository{}),
+	}
+}
+
+func fetchExcludedRepositories(ctx context.Context, meta schema.ClientMeta, parent *schema.Resource, res chan<- any) error {
+	c, ok := meta.(*client.Client)
+	if !ok {
+		return fmt.Errorf("failed to assert meta as *client.Client")
+	}
+
+	gitHubClient := c.GitHub()
+	if gitHubClient == nil {
+		return fmt.Errorf("GitHub client is not initialized for org %s", c.Org())
+	}
+
+	selection, err := cachedSelection(ctx, c, gitHubClient)
+	if err != nil {
+		return github.RedactError(fmt.Errorf("failed to fetch repositories for org %s: %w", c.Org(), err))
+	}
+
+	for _, r := range selection.rejected {
+		res <- &github.ExcludedRepository{
+			Org:      c.Org(),
+			FullName: r.repo.GetFullName(),
+			Name:     r.repo.GetName(),
+			Rule:     r.rule,
+			Topics:   r.repo.Topics,
+		}
+	}
+	// Entries in the repositories list that don't exist were never listed, but are recorded so they can be found
+	for _, name := range selection.missing {
+		res <- &github.ExcludedRepository{
+			Org:      c.Org(),
+			FullName: name.String(),
+			Name:     name.Name,
+			Rule:     "not_found",
+		}
+	}
+
+	c.Logger().Info().Int("excluded_count", len(selection.rejected)+len(selection.missing)).Msg("fetched excluded repositories")
+	return nil
+}
@@ -0,0 +1,16 @@
+package services
+
+import (
+	"github.com/cloudquery/plugin-sdk/v4/schema"
+	"github.com/guardian/cq-source-github-languages/client"
+)
+
+// orgMultiplex returns a client per configured organization so the scheduler can sync orgs in parallel
+func orgMultiplex(meta schema.ClientMeta) []schema.ClientMeta {
+	c := meta.(*client.Client)
+	clients := make([]schema.ClientMeta, 0, len(c.Orgs))
+	for _, org := range c.Orgs {
+		clients = append(clients, c.WithOrg(org))
+	}
+	return clients
+}
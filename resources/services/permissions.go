@@ -0,0 +1,38 @@
+package services
+
+import (
+	"slices"
+
+	"github.com/cloudquery/plugin-sdk/v4/schema"
+	"github.com/guardian/cq-source-github-languages/client"
+)
+
+// tablePermissions lists the GitHub App permissions each table needs to sync
+var tablePermissions = map[string]map[string]string{
+	"github_languages":                       {"metadata": "read"},
+	"github_languages_custom_properties":     {"organization_custom_properties": "read"},
+	"github_languages_excluded_repositories": {"metadata": "read"},
+	"github_repository_languages":            {"metadata": "read"},
+	"github_repository_teams":                {"metadata": "read"},
+}
+
+// RequiredPermissions returns the GitHub App permissions the named table needs to sync
+func RequiredPermissions(table string) map[string]string {
+	return tablePermissions[table]
+}
+
+// UnreadableTables checks the installation tokens can read each table. A table selected by name in
+// selected must be readable, so an error is returned for it; the names of other unreadable tables, selected
+// by a wildcard, are returned so the sync can skip them.
+func UnreadableTables(c *client.Client, tables schema.Tables, selected []string) ([]string, error) {
+	var unreadable []string
+	for _, table := range tables {
+		if err := c.CheckPermissions(table.Name, RequiredPermissions(table.Name)); err != nil {
+			if slices.Contains(selected, table.Name) {
+				return nil, err
+			}
+			unreadable = append(unreadable, table.Name)
+		}
+	}
+	return unreadable, nil
+}
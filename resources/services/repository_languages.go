@@ -0,0 +1,31 @@
+package services
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/cloudquery/plugin-sdk/v4/schema"
+	"github.com/cloudquery/plugin-sdk/v4/transformers"
+	"github.com/guardian/cq-source-github-languages/internal/github"
+)
+
+// RepositoryLanguagesTable is a child of github_languages with a row per language in each repository,
+// linked to its parent row by _cq_parent_id
+func RepositoryLanguagesTable() *schema.Table {
+	return &schema.Table{
+		Name:      "github_repository_languages",
+		Resolver:  fetchRepositoryLanguages,
+		Transform: transformers.TransformWithStruct(&github.RepositoryLanguage{}),
+	}
+}
+
+func fetchRepositoryLanguages(ctx context.Context, meta schema.ClientMeta, parent *schema.Resource, res chan<- any) error {
+	langs, ok := parent.Item.(*github.Languages)
+	if !ok {
+		return fmt.Errorf("failed to assert parent item as *github.Languages")
+	}
+	for _, language := range langs.Breakdown() {
+		res <- language
+	}
+	return nil
+}
@@ -0,0 +1,31 @@
+package services
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/cloudquery/plugin-sdk/v4/schema"
+	"github.com/cloudquery/plugin-sdk/v4/transformers"
+	"github.com/guardian/cq-source-github-languages/internal/github"
+)
+
+// RepositoryTeamsTable is a child of github_languages with a row per team that selected each repository,
+// linked to its parent row by _cq_parent_id. It is empty unless teams are configured.
+func RepositoryTeamsTable() *schema.Table {
+	return &schema.Table{
+		Name:      "github_repository_teams",
+		Resolver:  fetchRepositoryTeams,
+		Transform: transformers.TransformWithStruct(&github.RepositoryTeam{}),
+	}
+}
+
+func fetchRepositoryTeams(ctx context.Context, meta schema.ClientMeta, parent *schema.Resource, res chan<- any) error {
+	langs, ok := parent.Item.(*github.Languages)
+	if !ok {
+		return fmt.Errorf("failed to assert parent item as *github.Languages")
+	}
+	for _, team := range langs.Teams {
+		res <- &github.RepositoryTeam{FullName: langs.FullName, Team: team}
+	}
+	return nil
+}
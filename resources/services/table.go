@@ -2,7 +2,11 @@ package services
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"net/http"
+	"slices"
+	"strings"
 
 	"github.com/cloudquery/plugin-sdk/v4/transformers"
 
@@ -10,58 +14,268 @@ import (
 	gh "github.com/google/go-github/v57/github"
 	"github.com/guardian/cq-source-github-languages/client"
 	"github.com/guardian/cq-source-github-languages/internal/github"
+	"github.com/rs/zerolog"
 )
 
 func LanguagesTable() *schema.Table {
 	return &schema.Table{
 		Name:      "github_languages",
 		Resolver:  fetchLanguages,
-		Transform: transformers.TransformWithStruct(&github.Languages{}),
+		Multiplex: orgMultiplex,
+		Transform: transformers.TransformWithStruct(&github.Languages{}, transformers.WithSkipFields("Teams")),
+		Relations: schema.Tables{RepositoryLanguagesTable(), RepositoryTeamsTable()},
 	}
 }
 
-func contains(s []string, str string) bool {
-	for _, v := range s {
-		if v == str {
-			return true
+// rejectedRepo is a listed repository that the repository selection options ruled out
+type rejectedRepo struct {
+	repo *gh.Repository
+	// rule is the spec option that rejected the repository
+	rule string
+}
+
+// repoSelection is the outcome of selecting an organization's repositories
+type repoSelection struct {
+	repos []*gh.Repository
+	// teamsByRepo are the teams each repository was selected through, when teams are configured
+	teamsByRepo map[int64][]string
+	rejected    []rejectedRepo
+	// missing are entries in the repositories list that weren't found
+	missing []client.Repository
+}
+
+func filterForValidRepos(repos []*gh.Repository, filter client.RepositoryFilter) ([]*gh.Repository, []rejectedRepo) {
+	var validRepos []*gh.Repository
+	var rejected []rejectedRepo
+	for _, repo := range repos {
+		// we are filtering here to only include repos we care about
+		if rule := filter.Rejection(repo); rule != "" {
+			rejected = append(rejected, rejectedRepo{repo: repo, rule: rule})
+			continue
 		}
+		validRepos = append(validRepos, repo)
 	}
-	return false
+	return validRepos, rejected
 }
 
-func filterForValidRepos(repos []*gh.Repository) []*gh.Repository {
+// filterByCustomProperties keeps the repositories whose custom property values match the filter
+func filterByCustomProperties(repos []*gh.Repository, values []github.RepositoryCustomProperties, filter client.RepositoryFilter) ([]*gh.Repository, []rejectedRepo) {
+	propertiesByRepo := make(map[int64]map[string][]string, len(values))
+	for _, v := range values {
+		propertiesByRepo[v.RepositoryID] = v.Properties
+	}
+
 	var validRepos []*gh.Repository
+	var rejected []rejectedRepo
 	for _, repo := range repos {
-		// we are filtering here to only include repos we care about
-		if repo.Archived != nil && !*repo.Archived && contains(repo.Topics, "production") {
-			validRepos = append(validRepos, repo)
+		if !filter.MatchCustomProperties(propertiesByRepo[repo.GetID()]) {
+			rejected = append(rejected, rejectedRepo{repo: repo, rule: "custom_properties"})
+			continue
+		}
+		validRepos = append(validRepos, repo)
+	}
+	return validRepos, rejected
+}
+
+// cachedSelection returns the organization's repository selection. It is made once per sync, so
+// github_languages and github_languages_excluded_repositories list the organization once and agree.
+func cachedSelection(ctx context.Context, c *client.Client, gitHubClient *github.Client) (*repoSelection, error) {
+	selection, err := c.Memoize("selection:"+c.Org(), func() (any, error) {
+		return selectRepositories(ctx, c, gitHubClient)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return selection.(*repoSelection), nil
+}
+
+// selectRepositories finds the repositories to sync for the client's organization, from the repositories
+// list, the configured teams' repositories or all the organization's repositories
+func selectRepositories(ctx context.Context, c *client.Client, gitHubClient *github.Client) (*repoSelection, error) {
+	logger := c.Logger()
+	if len(c.Repositories) > 0 {
+		// Listed repositories are synced whatever the selection options
+		return fetchNamedRepositories(ctx, logger, gitHubClient.GitHubClient, c.OrgRepositories())
+	}
+
+	var selection *repoSelection
+	var err error
+	if len(c.Teams) > 0 {
+		selection, err = fetchTeamRepositories(ctx, logger, gitHubClient.GitHubClient, c.Org(), c.Teams, c.TeamPermission, c.Filter)
+	} else {
+		selection, err = fetchRepositories(ctx, logger, gitHubClient.GitHubClient, c.Org(), c.Filter)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if len(c.Filter.CustomProperties) > 0 {
+		values, err := gitHubClient.ListCustomPropertyValues(ctx, c.Org())
+		if err != nil {
+			return nil, fmt.Errorf("failed to list custom property values: %w", err)
 		}
+		var rejected []rejectedRepo
+		selection.repos, rejected = filterByCustomProperties(selection.repos, values, c.Filter)
+		selection.rejected = append(selection.rejected, rejected...)
 	}
-	return validRepos
+	return selection, nil
 }
 
-func fetchRepositories(ctx context.Context, ghClient *gh.Client, org string) ([]*gh.Repository, error) {
+func fetchRepositories(ctx context.Context, logger *zerolog.Logger, ghClient *gh.Client, org string, filter client.RepositoryFilter) (*repoSelection, error) {
 	opts := &gh.RepositoryListByOrgOptions{
+		Sort: filter.Sort,
 		ListOptions: gh.ListOptions{
 			PerPage: 100,
 		}}
+	if filter.Sort != client.SortFullName {
+		// Newest first, so listing can stop once repositories fall outside the activity window
+		opts.Direction = "desc"
+	}
 
-	var allRepos []*gh.Repository
+	selection := &repoSelection{}
 	for {
 		repos, resp, err := ghClient.Repositories.ListByOrg(ctx, org, opts)
 		if err != nil {
 			return nil, err
 		}
 
-		allRepos = append(allRepos, filterForValidRepos(repos)...)
+		validRepos, rejected := filterForValidRepos(repos, filter)
+		selection.repos = append(selection.repos, validRepos...)
+		selection.rejected = append(selection.rejected, rejected...)
 
-		fmt.Println("Counted ", len(allRepos), " repos so far")
+		logger.Debug().
+			Int("page", max(opts.Page, 1)).
+			Int("page_repos", len(repos)).
+			Int("page_matched", len(validRepos)).
+			Int("total_matched", len(selection.repos)).
+			Msg("listed repositories page")
 		if resp.NextPage == 0 {
 			break
 		}
+		if len(repos) > 0 && filter.PastWindow(repos[len(repos)-1]) {
+			logger.Debug().Str("sort", filter.Sort).Msg("remaining repositories are outside the activity window - stopping listing")
+			break
+		}
 		opts.Page = resp.NextPage
 	}
-	return allRepos, nil
+	return selection, nil
+}
+
+// teamPermissionLevels orders team_permission values so a team's access can be compared with the minimum
+var teamPermissionLevels = []string{client.TeamPermissionPush, client.TeamPermissionMaintain, client.TeamPermissionAdmin}
+
+// hasTeamPermission reports whether the team's permissions on a repository include the minimum, if there is one
+func hasTeamPermission(repo *gh.Repository, minimum string) bool {
+	if minimum == "" {
+		return true
+	}
+	// GitHub reports every level the team has, so admin access also sets maintain and push
+	i := slices.Index(teamPermissionLevels, minimum)
+	for _, level := range teamPermissionLevels[i:] {
+		if repo.GetPermissions()[level] {
+			return true
+		}
+	}
+	return false
+}
+
+// fetchTeamRepositories lists the repositories each team can access, in place of listing the whole organization.
+// A repository several teams can access is selected once, along with the teams it was selected through, and
+// is only rejected if no team selects it.
+func fetchTeamRepositories(ctx context.Context, logger *zerolog.Logger, ghClient *gh.Client, org string, teams []string, minimum string, filter client.RepositoryFilter) (*repoSelection, error) {
+	selection := &repoSelection{teamsByRepo: make(map[int64][]string)}
+	var rejected []rejectedRepo
+	for _, team := range teams {
+		opts := &gh.ListOptions{PerPage: 100}
+		for {
+			repos, resp, err := ghClient.Teams.ListTeamReposBySlug(ctx, org, team, opts)
+			if err != nil {
+				if resp != nil && resp.StatusCode == http.StatusNotFound {
+					return nil, fmt.Errorf("team %s was not found in org %s - check the slug and that the token can read teams", team, org)
+				}
+				return nil, fmt.Errorf("failed to list repositories for team %s: %w", team, err)
+			}
+
+			filtered, pageRejected := filterForValidRepos(repos, filter)
+			var validRepos []*gh.Repository
+			for _, repo := range filtered {
+				if !hasTeamPermission(repo, minimum) {
+					pageRejected = append(pageRejected, rejectedRepo{repo: repo, rule: "team_permission"})
+					continue
+				}
+				validRepos = append(validRepos, repo)
+				if _, seen := selection.teamsByRepo[repo.GetID()]; !seen {
+					selection.repos = append(selection.repos, repo)
+				}
+				selection.teamsByRepo[repo.GetID()] = append(selection.teamsByRepo[repo.GetID()], team)
+			}
+			rejected = append(rejected, pageRejected...)
+
+			logger.Debug().
+				Str("team", team).
+				Int("page", max(opts.Page, 1)).
+				Int("page_repos", len(repos)).
+				Int("page_matched", len(validRepos)).
+				Int("total_matched", len(selection.repos)).
+				Msg("listed team repositories page")
+			if resp.NextPage == 0 {
+				break
+			}
+			opts.Page = resp.NextPage
+		}
+	}
+
+	seen := make(map[int64]bool)
+	for _, r := range rejected {
+		id := r.repo.GetID()
+		if _, selected := selection.teamsByRepo[id]; selected || seen[id] {
+			continue
+		}
+		seen[id] = true
+		selection.rejected = append(selection.rejected, r)
+	}
+	return selection, nil
+}
+
+// fetchNamedRepositories fetches each repository in the repositories list individually. Repositories that
+// don't exist, or that the token can't see, are recorded as missing rather than failing the sync.
+func fetchNamedRepositories(ctx context.Context, logger *zerolog.Logger, ghClient *gh.Client, names []client.Repository) (*repoSelection, error) {
+	selection := &repoSelection{}
+	for _, name := range names {
+		repo, _, err := ghClient.Repositories.Get(ctx, name.Owner, name.Name)
+		if err != nil {
+			var errResp *gh.ErrorResponse
+			if errors.As(err, &errResp) && errResp.Response != nil && errResp.Response.StatusCode == http.StatusNotFound {
+				logger.Warn().Str("repo", name.String()).Msg("repository not found - skipping it")
+				selection.missing = append(selection.missing, name)
+				continue
+			}
+			return nil, fmt.Errorf("failed to get repository %s: %w", name, err)
+		}
+		selection.repos = append(selection.repos, repo)
+	}
+	return selection, nil
+}
+
+// restrictToRepositories returns a client whose installation token can only access the given repositories.
+// GitHub limits how many repositories a token can be restricted to, so larger orgs keep the org-wide token.
+func restrictToRepositories(logger *zerolog.Logger, gitHubClient *github.Client, repos []*gh.Repository) (*github.Client, error) {
+	if len(repos) == 0 {
+		return gitHubClient, nil
+	}
+	if len(repos) > github.MaxTokenRepositories {
+		logger.Warn().
+			Int("repo_count", len(repos)).
+			Int("limit", github.MaxTokenRepositories).
+			Msg("too many repositories to restrict the installation token - using the organization-wide token")
+		return gitHubClient, nil
+	}
+
+	ids := make([]int64, 0, len(repos))
+	for _, repo := range repos {
+		ids = append(ids, repo.GetID())
+	}
+	return gitHubClient.RestrictToRepositories(ids)
 }
 
 func fetchLanguages(ctx context.Context, meta schema.ClientMeta, parent *schema.Resource, res chan<- any) error {
@@ -73,25 +287,29 @@ func fetchLanguages(ctx context.Context, meta schema.ClientMeta, parent *schema.
 	logger := c.Logger()
 	logger.Info().Msg("starting language fetch process")
 
-	// Initialize GitHub client with App authentication
-	privateKeyBytes := []byte(c.PrivateKey)
-	gitHubClient, err := github.NewGitHubAppClient(ctx, c.AppID, c.InstallationID, privateKeyBytes)
-	if err != nil {
-		logger.Error().Err(err).Msg("failed to create GitHub App client")
-		return fmt.Errorf("failed to create GitHub App client: %w", err)
+	gitHubClient := c.GitHub()
+	if gitHubClient == nil {
+		return fmt.Errorf("GitHub client is not initialized for org %s", c.Org())
 	}
 
 	logger.Info().Str("org", c.Org()).Msg("fetching repositories")
 
-	// Use the official GitHub client for fetchRepositories
-	repos, err := fetchRepositories(ctx, gitHubClient.GitHubClient, c.Org())
+	selection, err := cachedSelection(ctx, c, gitHubClient)
 	if err != nil {
-		logger.Error().Err(err).Str("org", c.Org()).Msg("failed to fetch repositories")
-		return fmt.Errorf("failed to fetch repositories for org %s: %w", c.Org(), err)
+		logger.Error().Err(github.RedactError(err)).Str("org", c.Org()).Msg("failed to fetch repositories")
+		return github.RedactError(fmt.Errorf("failed to fetch repositories for org %s: %w", c.Org(), err))
 	}
+	repos := selection.repos
 
 	logger.Info().Int("repo_count", len(repos)).Msg("fetched repositories, now getting languages")
 
+	if c.Spec.RestrictToRepositories {
+		gitHubClient, err = restrictToRepositories(logger, gitHubClient, repos)
+		if err != nil {
+			return github.RedactError(fmt.Errorf("failed to restrict installation token for org %s: %w", c.Org(), err))
+		}
+	}
+
 	// Use our internal client wrapper for GetLanguages calls
 	for i, repo := range repos {
 		if repo.Owner == nil || repo.Owner.Login == nil || repo.Name == nil {
@@ -102,11 +320,11 @@ func fetchLanguages(ctx context.Context, meta schema.ClientMeta, parent *schema.
 		langs, err := gitHubClient.GetLanguages(ctx, *repo.Owner.Login, *repo.Name)
 		if err != nil {
 			logger.Error().
-				Err(err).
+				Err(github.RedactError(err)).
 				Str("owner", *repo.Owner.Login).
 				Str("repo", *repo.Name).
 				Msg("failed to get languages for repository")
-			return fmt.Errorf("failed to get languages for %s/%s: %w", *repo.Owner.Login, *repo.Name, err)
+			return github.RedactError(fmt.Errorf("failed to get languages for %s/%s: %w", *repo.Owner.Login, *repo.Name, err))
 		}
 
 		logger.Debug().
@@ -114,9 +332,20 @@ func fetchLanguages(ctx context.Context, meta schema.ClientMeta, parent *schema.
 			Int("language_count", len(langs.Languages)).
 			Msg("fetched languages for repository")
 
+		langs.Org = c.Org()
+		langs.Teams = selection.teamsByRepo[repo.GetID()]
 		res <- langs
 	}
 
 	logger.Info().Int("total_repos", len(repos)).Msg("completed language fetch process")
+
+	// Report missing repositories in the sync results once everything else has been synced
+	if len(selection.missing) > 0 {
+		missing := make([]string, 0, len(selection.missing))
+		for _, name := range selection.missing {
+			missing = append(missing, name.String())
+		}
+		return fmt.Errorf("repositories not found in org %s: %s", c.Org(), strings.Join(missing, ", "))
+	}
 	return nil
 }